@@ -3,14 +3,15 @@ package goharbor
 import (
 	"bytes"
 	"errors"
-	"io/ioutil"
 	"strconv"
 	"strings"
+	"time"
 
 	"goharbor/grequests"
 )
 
 // MetadataStruct 对象元数据
+// 字符串类型的时间和权限字段为服务器返回的原始值，解码时会解析到对应的类型化字段
 type MetadataStruct struct {
 	PathName         string `json:"na"`                     //全路径
 	Name             string `json:"name"`                   //对象或目录名称
@@ -22,6 +23,20 @@ type MetadataStruct struct {
 	DownloadCount    uint32 `json:"dlc"`                    //下载次数
 	DownloadURL      string `json:"download_url,omitempty"` // 下载url
 	AccessPermission string `json:"access_permission"`      // 访问权限
+
+	Uploaded   time.Time  `json:"-"` // 解析后的上传时间，无法解析时为零值
+	Updated    time.Time  `json:"-"` // 解析后的最后修改时间，无法解析时为零值
+	Permission Permission `json:"-"` // 解析后的访问权限
+}
+
+// bytesReadCloser 可重复读取（Seek）的数据块，Close为空操作
+type bytesReadCloser struct {
+	*bytes.Reader
+}
+
+// Close 实现io.Closer
+func (bytesReadCloser) Close() error {
+	return nil
 }
 
 // APIWrapper EVHarbor API wrapper
@@ -61,7 +76,7 @@ func (api APIWrapper) UploadOneChunk(bucketName, dirPath, objName string, offset
 
 	files := []grequests.FileUpload{
 		{
-			FileContents: ioutil.NopCloser(bytes.NewReader(chunk)),
+			FileContents: limitReader(bytesReadCloser{bytes.NewReader(chunk)}, api.configs.RateLimiter),
 			FieldName:    "chunk",
 			FileMime:     "application/octet-stream",
 		},
@@ -100,6 +115,9 @@ func (api APIWrapper) DownloadOneChunk(bucketName, dirPath, objName string, offs
 	if err != nil {
 		return nil, err
 	}
+	if r.RawResponse != nil && r.StatusCode == 200 {
+		r.RawResponse.Body = limitReader(r.RawResponse.Body, api.configs.RateLimiter)
+	}
 
 	return r, nil
 }
@@ -221,6 +239,36 @@ func (api APIWrapper) MoveRenameObject(bucketName, dirPath, objName, moveTo, ren
 	return r, nil
 }
 
+// MoveRenameDir 移动或重命名一个目录（需要服务器支持目录移动）
+// param bucket_name: 桶名称
+// param dirPath: 桶下目录所在路径
+// param dirName: 目录名称
+// param moveTo: 移动目录到此目录路径，""为不移动, "/"为根目录
+// param rename: 重命名目录，""为不重命名
+func (api APIWrapper) MoveRenameDir(bucketName, dirPath, dirName, moveTo, rename string) (*grequests.Response, error) {
+
+	req := RequestStruct{configs: api.configs}
+	builder := apiBuilderStruct{configs: api.configs}
+
+	params := make(map[string]string)
+	if moveTo != "" {
+		params["move_to"] = moveTo
+	}
+
+	if rename != "" {
+		params["rename"] = rename
+	}
+
+	url := builder.buildMoveDirAPI(bucketName, dirPath, dirName, &params)
+
+	r, err := req.Post(url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
 // ObjectPermission 对象公有或私有访问权限设置
 // param bucket_name: 桶名称
 // param dirPath: 桶下对象所在路径
@@ -250,3 +298,28 @@ func (api APIWrapper) ObjectPermission(bucketName, dirPath, objName string, shar
 
 	return r, nil
 }
+
+// DirPermission 目录公有或私有访问权限设置
+// param bucket_name: 桶名称
+// param dirPath: 桶下目录所在路径
+// param dirName: 目录名称
+// param share: 是否分享公开，用于设置目录公有或私有, true(公有)，false(私有)
+// param days: 目录公开分享天数(share=true时有效)，0表示永久公开，负数表示不公开，默认为0
+func (api APIWrapper) DirPermission(bucketName, dirPath, dirName string, share bool, days int) (*grequests.Response, error) {
+
+	req := RequestStruct{configs: api.configs}
+	builder := apiBuilderStruct{configs: api.configs}
+
+	params := make(map[string]string)
+	params["share"] = strconv.FormatBool(share)
+	params["days"] = strconv.Itoa(days)
+
+	url := builder.buildDirAPI(bucketName, dirPath, dirName, &params)
+
+	r, err := req.Patch(url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
@@ -23,6 +23,12 @@ func (builder apiBuilderStruct) getConfigs() *ConfigStruct {
 	return &(builder.configs)
 }
 
+// buildAPIPath 按配置的API版本构建api路径（未编码）
+func (builder apiBuilderStruct) buildAPIPath(prefix string, parts ...string) string {
+	configs := builder.getConfigs()
+	return getAPIVersionSpec(configs).path(configs, prefix, parts) + "/"
+}
+
 // buildURL return url.URL结构体对象
 // If you do not intend to use the `params` you can just pass nil
 func (builder apiBuilderStruct) buildURL(urlPath string, params *map[string]string) url.URL {
@@ -51,8 +57,7 @@ func (builder apiBuilderStruct) buildURL(urlPath string, params *map[string]stri
 func (builder apiBuilderStruct) buildObjAPI(bucketName, dirPath, objName string, params *map[string]string) string {
 	configs := builder.getConfigs()
 
-	slice := []string{"api", configs.Version, configs.APIObjPrefix, bucketName, dirPath, objName}
-	path := buildPath(slice) + "/"
+	path := builder.buildAPIPath(configs.APIObjPrefix, bucketName, dirPath, objName)
 
 	url := builder.buildURL(path, params)
 	return url.String()
@@ -63,8 +68,7 @@ func (builder apiBuilderStruct) buildObjAPI(bucketName, dirPath, objName string,
 func (builder apiBuilderStruct) buildMetadataAPI(bucketName, pathName string, params *map[string]string) string {
 	configs := builder.getConfigs()
 
-	slice := []string{"api", configs.Version, configs.APIMetadataPrefix, bucketName, pathName}
-	path := buildPath(slice) + "/"
+	path := builder.buildAPIPath(configs.APIMetadataPrefix, bucketName, pathName)
 
 	url := builder.buildURL(path, params)
 	return url.String()
@@ -75,8 +79,7 @@ func (builder apiBuilderStruct) buildMetadataAPI(bucketName, pathName string, pa
 func (builder apiBuilderStruct) buildDirAPI(bucketName, dirPath, dirName string, params *map[string]string) string {
 	configs := builder.getConfigs()
 
-	slice := []string{"api", configs.Version, configs.APIDirPrefix, bucketName, dirPath, dirName}
-	path := buildPath(slice) + "/"
+	path := builder.buildAPIPath(configs.APIDirPrefix, bucketName, dirPath, dirName)
 
 	url := builder.buildURL(path, params)
 	return url.String()
@@ -87,8 +90,7 @@ func (builder apiBuilderStruct) buildDirAPI(bucketName, dirPath, dirName string,
 func (builder apiBuilderStruct) buildBucketAPI(bucketID string, params *map[string]string) string {
 	configs := builder.getConfigs()
 
-	slice := []string{"api", configs.Version, configs.APIBucketPrefix, bucketID}
-	path := buildPath(slice) + "/"
+	path := builder.buildAPIPath(configs.APIBucketPrefix, bucketID)
 
 	url := builder.buildURL(path, params)
 	return url.String()
@@ -99,8 +101,18 @@ func (builder apiBuilderStruct) buildBucketAPI(bucketID string, params *map[stri
 func (builder apiBuilderStruct) buildMoveAPI(bucketName, dirPath, objName string, params *map[string]string) string {
 	configs := builder.getConfigs()
 
-	slice := []string{"api", configs.Version, configs.APIMovePrefix, bucketName, dirPath, objName}
-	path := buildPath(slice) + "/"
+	path := builder.buildAPIPath(configs.APIMovePrefix, bucketName, dirPath, objName)
+
+	url := builder.buildURL(path, params)
+	return url.String()
+}
+
+// buildMoveDirAPI 构建目录移动重命名api url（已编码）
+// If you do not intend to use the `params` you can just pass nil
+func (builder apiBuilderStruct) buildMoveDirAPI(bucketName, dirPath, dirName string, params *map[string]string) string {
+	configs := builder.getConfigs()
+
+	path := builder.buildAPIPath(configs.APIMoveDirPrefix, bucketName, dirPath, dirName)
 
 	url := builder.buildURL(path, params)
 	return url.String()
@@ -111,8 +123,7 @@ func (builder apiBuilderStruct) buildMoveAPI(bucketName, dirPath, objName string
 func (builder apiBuilderStruct) buildStatsAPI(bucketName string, params *map[string]string) string {
 	configs := builder.getConfigs()
 
-	slice := []string{"api", configs.Version, configs.APIStatsPrefix, bucketName}
-	path := buildPath(slice) + "/"
+	path := builder.buildAPIPath(configs.APIStatsPrefix, bucketName)
 
 	url := builder.buildURL(path, params)
 	return url.String()
@@ -0,0 +1,280 @@
+package goharbor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ArchiveFormat 目录归档格式
+type ArchiveFormat int
+
+const (
+	// ArchiveTar tar
+	ArchiveTar ArchiveFormat = iota
+	// ArchiveTarGz gzip压缩的tar
+	ArchiveTarGz
+	// ArchiveZip zip，文件以deflate压缩
+	ArchiveZip
+)
+
+// ArchiveReturn 目录归档下载结果
+type ArchiveReturn struct {
+	Results
+	Dirs  int   // 归档的目录数，不含根目录
+	Files int   // 归档的对象数
+	Bytes int64 // 归档的对象数据字节数
+}
+
+// archiveWriter 按格式写入归档
+type archiveWriter interface {
+	dir(name string, modTime time.Time) error
+	file(name string, size int64, mode os.FileMode, modTime time.Time) (io.Writer, error)
+	close() error
+}
+
+type tarArchive struct {
+	tw *tar.Writer
+	gz *gzip.Writer // nil为不压缩
+}
+
+func (a tarArchive) dir(name string, modTime time.Time) error {
+	return a.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: 0755, ModTime: modTime})
+}
+
+func (a tarArchive) file(name string, size int64, mode os.FileMode, modTime time.Time) (io.Writer, error) {
+	err := a.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: int64(mode.Perm()), ModTime: modTime})
+	return a.tw, err
+}
+
+func (a tarArchive) close() error {
+	err := a.tw.Close()
+	if a.gz != nil {
+		if e := a.gz.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a zipArchive) dir(name string, modTime time.Time) error {
+	h := &zip.FileHeader{Name: name + "/", Modified: modTime}
+	h.SetMode(os.ModeDir | 0755)
+	_, err := a.zw.CreateHeader(h)
+	return err
+}
+
+func (a zipArchive) file(name string, size int64, mode os.FileMode, modTime time.Time) (io.Writer, error) {
+	h := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+	h.SetMode(mode.Perm())
+	return a.zw.CreateHeader(h)
+}
+
+func (a zipArchive) close() error {
+	return a.zw.Close()
+}
+
+func newArchiveWriter(w io.Writer, format ArchiveFormat) (archiveWriter, error) {
+	switch format {
+	case ArchiveTar:
+		return tarArchive{tw: tar.NewWriter(w)}, nil
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(w)
+		return tarArchive{tw: tar.NewWriter(gz), gz: gz}, nil
+	case ArchiveZip:
+		return zipArchive{zw: zip.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown archive format %d", format)
+}
+
+// writeLocalArchive 把本地目录树写为归档，只包含目录和普通文件
+func writeLocalArchive(w io.Writer, localDir string, format ArchiveFormat) error {
+	aw, err := newArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+	err = filepath.Walk(localDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if fi.IsDir() {
+			return aw.dir(name, fi.ModTime())
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		fw, err := aw.file(name, fi.Size(), fi.Mode(), fi.ModTime())
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(fw, file)
+		return err
+	})
+	if e := aw.close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// UploadDirAsArchive 把本地目录树打包为一个归档对象，边打包边分片上传，不使用临时文件
+// 归档的压缩由format决定，不使用Compression；配置了Encryption时加密上传
+// param bucketName: 桶名称
+// param objPathName: 桶下全路径对象名称，如 "runs/20201018.tar.gz"
+// param localDir: 本地目录
+// param format: 归档格式
+func (client ClientStruct) UploadDirAsArchive(bucketName, objPathName, localDir string, format ArchiveFormat) (*ObjReturn, error) {
+
+	client, span := client.startSpan("UploadDirAsArchive", "bucket", bucketName, "object", objPathName, "local_dir", localDir)
+	ret, err := client.uploadDirAsArchive(bucketName, objPathName, localDir, format)
+	endObjSpan(span, ret, err)
+	return ret, err
+}
+
+// uploadDirAsArchive 把本地目录树打包为一个归档对象上传
+func (client ClientStruct) uploadDirAsArchive(bucketName, objPathName, localDir string, format ArchiveFormat) (*ObjReturn, error) {
+	if fi, err := os.Stat(localDir); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, errors.New(localDir + " is not a directory")
+	}
+	if _, err := newArchiveWriter(io.Discard, format); err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeLocalArchive(pw, localDir, format))
+	}()
+	// 上传失败时关闭管道，结束打包
+	defer pr.Close()
+	return client.uploadStream(bucketName, objPathName, pr)
+}
+
+// DownloadDirAsZip 把桶下目录树以zip格式流式写入w，数据不经过本地磁盘
+// 加密的对象解密后归档，压缩上传的对象按压缩后的内容和名称归档
+// param bucketName: 桶名称
+// param dirPathName: 桶下全路径目录名称，""为桶根目录
+// param w: 归档写入的目标
+func (client ClientStruct) DownloadDirAsZip(bucketName, dirPathName string, w io.Writer) (*ArchiveReturn, error) {
+	return client.downloadDirAsArchive("DownloadDirAsZip", bucketName, dirPathName, w, ArchiveZip)
+}
+
+// DownloadDirAsTar 把桶下目录树以tar格式流式写入w，数据不经过本地磁盘
+// 加密的对象解密后归档，压缩上传的对象按压缩后的内容和名称归档
+// param bucketName: 桶名称
+// param dirPathName: 桶下全路径目录名称，""为桶根目录
+// param w: 归档写入的目标，可以用gzip.Writer包装得到tar.gz
+func (client ClientStruct) DownloadDirAsTar(bucketName, dirPathName string, w io.Writer) (*ArchiveReturn, error) {
+	return client.downloadDirAsArchive("DownloadDirAsTar", bucketName, dirPathName, w, ArchiveTar)
+}
+
+func (client ClientStruct) downloadDirAsArchive(spanName, bucketName, dirPathName string, w io.Writer, format ArchiveFormat) (*ArchiveReturn, error) {
+	client, span := client.startSpan(spanName, "bucket", bucketName, "dir", dirPathName)
+	ret, err := client.WithCompression(nil).writeRemoteArchive(bucketName, dirPathName, w, format)
+	if ret != nil {
+		setSpanAttributes(span, "files", ret.Files, "bytes", ret.Bytes)
+		endResultSpan(span, &ret.Results, err)
+	} else {
+		endSpan(span, err)
+	}
+	return ret, err
+}
+
+// writeRemoteArchive 遍历桶下目录树并写为归档
+// 服务器返回失败时返回Results，此时已写入w的归档不完整
+func (client ClientStruct) writeRemoteArchive(bucketName, dirPathName string, w io.Writer, format ArchiveFormat) (*ArchiveReturn, error) {
+	aw, err := newArchiveWriter(w, format)
+	if err != nil {
+		return nil, err
+	}
+	ret := &ArchiveReturn{}
+	root := buildPath([]string{dirPathName})
+	err = client.archiveRemoteDir(aw, bucketName, root, "", ret)
+	if res, ok := err.(Results); ok {
+		ret.Results = res
+		return ret, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := aw.close(); err != nil {
+		return nil, err
+	}
+	ret.Ok = true
+	ret.CodeText = "archive ok"
+	return ret, nil
+}
+
+// archiveRemoteDir 递归归档一个桶下目录
+// param rel: 目录在归档中的相对路径，""为根目录
+func (client ClientStruct) archiveRemoteDir(aw archiveWriter, bucketName, dirPathName, rel string, ret *ArchiveReturn) error {
+	files, err := client.Dir(bucketName, dirPathName).listAll()
+	if err != nil {
+		return err
+	}
+	for _, m := range files {
+		name := buildPath([]string{rel, m.Name})
+		pathName := buildPath([]string{dirPathName, m.Name})
+		if !m.IsObject() {
+			if err := aw.dir(name, m.ModTime()); err != nil {
+				return err
+			}
+			ret.Dirs++
+			if err := client.archiveRemoteDir(aw, bucketName, pathName, name, ret); err != nil {
+				return err
+			}
+			continue
+		}
+
+		size := int64(m.Size)
+		if client.API.configs.Encryption != nil {
+			if size, _, err = plainObjectSize(size); err != nil {
+				return fmt.Errorf("%s: %w", pathName, err)
+			}
+		}
+		fw, err := aw.file(name, size, 0644, m.ModTime())
+		if err != nil {
+			return err
+		}
+		n, err := client.copyObjectTo(fw, bucketName, pathName)
+		ret.Bytes += n
+		if err != nil {
+			return err
+		}
+		if n != size {
+			return fmt.Errorf("%s: read %d bytes, metadata size is %d", pathName, n, size)
+		}
+		ret.Files++
+	}
+	return nil
+}
+
+// copyObjectTo 把对象数据写入w，返回写入的字节数
+func (client ClientStruct) copyObjectTo(w io.Writer, bucketName, objPathName string) (int64, error) {
+	rc, err := client.OpenObject(bucketName, objPathName)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	return io.Copy(w, rc)
+}
@@ -0,0 +1,144 @@
+package goharbor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readTar 读取tar归档，目录名以"/"结尾，值为空
+func readTar(t *testing.T, r io.Reader) map[string]string {
+	entries := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(tr)
+		entries[h.Name] = string(data)
+	}
+}
+
+func readZip(t *testing.T, data []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		entries[f.Name] = string(data)
+	}
+	return entries
+}
+
+func compareEntries(t *testing.T, got, want map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("archive has %d entries, want %d: %v", len(got), len(want), got)
+	}
+	for name, data := range want {
+		if d, ok := got[name]; !ok || d != data {
+			t.Errorf("entry %s = %d bytes, %v", name, len(d), ok)
+		}
+	}
+}
+
+func TestUploadDirAsArchive(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	client := server.client()
+
+	dir := t.TempDir()
+	big := strings.Repeat("0123456789", streamChunkSize/10+1)
+	os.MkdirAll(filepath.Join(dir, "sub", "deep"), 0755)
+	os.MkdirAll(filepath.Join(dir, "empty"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("b"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "deep", "c.bin"), []byte(big), 0644)
+	want := map[string]string{
+		"a.txt": "a", "empty/": "", "sub/": "", "sub/b.txt": "b", "sub/deep/": "", "sub/deep/c.bin": big,
+	}
+
+	ret, err := client.UploadDirAsArchive("b", "runs/run.tar.gz", dir, ArchiveTarGz)
+	if err != nil || !ret.IsDone() {
+		t.Fatalf("UploadDirAsArchive() = %+v, %v", ret, err)
+	}
+	stored, _ := server.get("b/runs/run.tar.gz")
+	gz, err := gzip.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareEntries(t, readTar(t, gz), want)
+
+	if ret, err := client.UploadDirAsArchive("b", "runs/run.zip", dir, ArchiveZip); err != nil || !ret.IsDone() {
+		t.Fatalf("UploadDirAsArchive(zip) = %+v, %v", ret, err)
+	}
+	stored, _ = server.get("b/runs/run.zip")
+	compareEntries(t, readZip(t, stored), want)
+
+	if _, err := client.UploadDirAsArchive("b", "runs/x.tar", filepath.Join(dir, "missing"), ArchiveTar); err == nil {
+		t.Error("missing local directory should fail")
+	}
+}
+
+func TestDownloadDirAsArchive(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	provider, _ := InitStaticKeyProvider("k1", bytes.Repeat([]byte{1}, 32))
+	client := server.client().WithEncryption(InitEncryption(provider))
+
+	want := map[string]string{
+		"x.txt":       "x",
+		"d/":          "",
+		"d/y.txt":     strings.Repeat("y", 3*EncryptionSegmentSize),
+		"d/e/":        "",
+		"d/e/empty":   "",
+		"d/e/z.csv":   "z,z",
+		"d/e/f/":      "",
+		"d/e/f/w.log": "w",
+	}
+	for name, data := range want {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		if ret, err := client.UploadReader("b", "data/"+name, strings.NewReader(data)); err != nil || !ret.Ok {
+			t.Fatalf("UploadReader(%s) = %+v, %v", name, ret, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	ret, err := client.DownloadDirAsTar("b", "data", &buf)
+	if err != nil || !ret.Ok || ret.Files != 5 || ret.Dirs != 3 {
+		t.Fatalf("DownloadDirAsTar() = %+v, %v", ret, err)
+	}
+	compareEntries(t, readTar(t, &buf), want)
+
+	buf.Reset()
+	ret, err = client.DownloadDirAsZip("b", "data/", &buf)
+	if err != nil || !ret.Ok || ret.Bytes != int64(3*EncryptionSegmentSize+5) {
+		t.Fatalf("DownloadDirAsZip() = %+v, %v", ret, err)
+	}
+	compareEntries(t, readZip(t, buf.Bytes()), want)
+
+	ret, err = client.DownloadDirAsZip("b", "nope", ioutil.Discard)
+	if err != nil || ret.Ok || ret.Code != 404 {
+		t.Errorf("DownloadDirAsZip(missing) = %+v, %v", ret, err)
+	}
+}
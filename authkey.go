@@ -27,6 +27,14 @@ type AuthKey struct {
 func (ak AuthKey) Key(uri string, method string, timedelta int64) string {
 	deadline := time.Now().Unix() + timedelta //获取时间戳
 
+	return ak.KeyWithDeadline(uri, method, deadline)
+}
+
+// KeyWithDeadline 生成指定截止时间的访问密钥
+// param uri: 未编码的原始全路径（path?query）字符串
+// param method: 请求方法 GET POST PUT PATCH等
+// param deadline: 安全凭证的截止时间戳，单位为秒s
+func (ak AuthKey) KeyWithDeadline(uri string, method string, deadline int64) string {
 	body := jsonBodyStruct{PathOfURL: uri, Method: method, Deadline: deadline}
 	data, _ := json.Marshal(body)
 	dataBase64 := base64.URLEncoding.EncodeToString(data)
@@ -0,0 +1,205 @@
+package goharbor
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errUnknownBatchOp 未知的批量操作类型
+var errUnknownBatchOp = errors.New("unknown batch operation type")
+
+// BatchOpType 批量操作类型
+type BatchOpType uint8
+
+const (
+	// BatchDelete 删除对象
+	BatchDelete BatchOpType = iota
+	// BatchMoveRename 移动或重命名对象
+	BatchMoveRename
+	// BatchPermission 设置对象访问权限
+	BatchPermission
+)
+
+// BatchOp 一个批量操作项
+type BatchOp struct {
+	Type        BatchOpType
+	BucketName  string // 桶名称
+	ObjPathName string // 桶下全路径对象名称
+	MoveTo      string // BatchMoveRename: 移动对象到此目录路径，""为不移动, "/"为根目录
+	Rename      string // BatchMoveRename: 重命名对象，""为不重命名
+	Share       bool   // BatchPermission: 是否分享公开
+	Days        int    // BatchPermission: 公开分享天数，0表示永久公开
+}
+
+// DeleteOp 构建一个删除对象的批量操作项
+func DeleteOp(bucketName, objPathName string) BatchOp {
+	return BatchOp{Type: BatchDelete, BucketName: bucketName, ObjPathName: objPathName}
+}
+
+// MoveRenameOp 构建一个移动或重命名对象的批量操作项
+func MoveRenameOp(bucketName, objPathName, moveTo, rename string) BatchOp {
+	return BatchOp{Type: BatchMoveRename, BucketName: bucketName, ObjPathName: objPathName, MoveTo: moveTo, Rename: rename}
+}
+
+// PermissionOp 构建一个设置对象访问权限的批量操作项
+func PermissionOp(bucketName, objPathName string, share bool, days int) BatchOp {
+	return BatchOp{Type: BatchPermission, BucketName: bucketName, ObjPathName: objPathName, Share: share, Days: days}
+}
+
+// BatchOptions 批量操作选项
+type BatchOptions struct {
+	Concurrency int           // 并发数，<=0时为4
+	Retries     int           // 失败后的重试次数（仅对网络错误、429和5xx状态码重试，移动重命名仅对429重试）
+	RetryDelay  time.Duration // 重试间隔，每次重试翻倍，<=0时为500ms
+	StopOnError bool          // 是否在第一个失败后停止执行尚未开始的操作
+}
+
+// BatchResult 单个批量操作项的结果
+type BatchResult struct {
+	Results
+	Op       BatchOp
+	Err      error // 网络等错误
+	Attempts int   // 实际执行次数，0表示因StopOnError被跳过
+}
+
+// Skipped 操作是否被跳过
+func (br BatchResult) Skipped() bool {
+	return br.Attempts == 0
+}
+
+// BatchSummary 批量操作结果统计
+type BatchSummary struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	Skipped   int
+}
+
+// BatchReturn 批量操作结果
+type BatchReturn struct {
+	Items   []BatchResult // 与请求的操作项一一对应
+	Summary BatchSummary
+}
+
+// Ok 是否全部操作都成功
+func (br BatchReturn) Ok() bool {
+	return br.Summary.Succeeded == br.Summary.Total
+}
+
+// Batch 并发执行一组批量操作
+// param ops: 批量操作项
+// param opts: 批量操作选项，nil使用默认选项
+func (client ClientStruct) Batch(ops []BatchOp, opts *BatchOptions) *BatchReturn {
+	o := BatchOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 4
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = 500 * time.Millisecond
+	}
+
+	ret := &BatchReturn{Items: make([]BatchResult, len(ops))}
+	for i, op := range ops {
+		ret.Items[i].Op = op
+	}
+
+	var stopped int32
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < o.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if atomic.LoadInt32(&stopped) == 1 {
+					continue
+				}
+				item := &ret.Items[i]
+				client.runBatchOp(item, o)
+				if !item.Ok && o.StopOnError {
+					atomic.StoreInt32(&stopped, 1)
+				}
+			}
+		}()
+	}
+	for i := range ops {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	ret.Summary.Total = len(ops)
+	for _, item := range ret.Items {
+		switch {
+		case item.Skipped():
+			ret.Summary.Skipped++
+		case item.Ok:
+			ret.Summary.Succeeded++
+		default:
+			ret.Summary.Failed++
+		}
+	}
+	return ret
+}
+
+// runBatchOp 执行一个操作项，必要时重试
+func (client ClientStruct) runBatchOp(item *BatchResult, o BatchOptions) {
+	delay := o.RetryDelay
+	for {
+		item.Attempts++
+		r, err := client.doBatchOp(item.Op, item.Attempts > 1)
+		item.Err = err
+		if r != nil {
+			item.Results = *r
+		} else {
+			item.Results = Results{CodeText: err.Error()}
+		}
+		if item.Ok || item.Attempts > o.Retries || !isRetryable(r, err) || !batchReplayable(item.Op, r) {
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// doBatchOp 执行一次操作
+// param retry: 是否为重试，重试删除时对象不存在视为成功（之前失败的请求可能已在服务器上执行）
+func (client ClientStruct) doBatchOp(op BatchOp, retry bool) (*Results, error) {
+	switch op.Type {
+	case BatchDelete:
+		if retry {
+			return client.resetObject(op.BucketName, op.ObjPathName)
+		}
+		return client.DeleteObject(op.BucketName, op.ObjPathName)
+	case BatchMoveRename:
+		r, err := client.MoveRenameObject(op.BucketName, op.ObjPathName, op.MoveTo, op.Rename)
+		if err != nil {
+			return nil, err
+		}
+		return &r.Results, nil
+	case BatchPermission:
+		r, _, err := client.setObjectPermission(op.BucketName, op.ObjPathName, op.Share, op.Days)
+		return r, err
+	}
+	return nil, errUnknownBatchOp
+}
+
+// batchReplayable 失败的操作能否重新执行
+// 网络错误和5xx时服务器可能已经执行了操作：删除和设置权限重复执行结果相同，
+// 移动重命名重复执行会失败或移动错误的对象，只在服务器拒绝执行（429）时重试
+func batchReplayable(op BatchOp, r *Results) bool {
+	return op.Type != BatchMoveRename || (r != nil && r.Code == 429)
+}
+
+// isRetryable 失败的操作是否值得重试
+func isRetryable(r *Results, err error) bool {
+	if err != nil {
+		return err != errUnknownBatchOp
+	}
+	return r.Code == 429 || r.Code >= 500
+}
@@ -0,0 +1,97 @@
+package goharbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientStruct_Batch(t *testing.T) {
+	var flaky int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "missing"):
+			w.WriteHeader(404)
+		case strings.Contains(r.URL.Path, "flaky") && atomic.AddInt32(&flaky, 1) == 1:
+			w.WriteHeader(503)
+		default:
+			w.WriteHeader(204)
+		}
+	}))
+	defer server.Close()
+
+	client := testClient(server.URL)
+
+	ops := []BatchOp{
+		DeleteOp("b", "a/1.txt"),
+		DeleteOp("b", "a/missing.txt"),
+		DeleteOp("b", "a/flaky.txt"),
+		{Type: BatchOpType(99), BucketName: "b", ObjPathName: "a/2.txt"},
+	}
+	ret := client.Batch(ops, &BatchOptions{Concurrency: 2, Retries: 1, RetryDelay: time.Millisecond})
+
+	want := BatchSummary{Total: 4, Succeeded: 2, Failed: 2}
+	if ret.Summary != want {
+		t.Errorf("Summary = %+v, want %+v", ret.Summary, want)
+	}
+	if ret.Items[2].Attempts != 2 || !ret.Items[2].Ok {
+		t.Errorf("flaky item should succeed on retry, got %+v", ret.Items[2])
+	}
+	if ret.Items[1].Attempts != 1 || ret.Items[1].Code != 404 {
+		t.Errorf("missing item should not be retried, got %+v", ret.Items[1])
+	}
+	if ret.Items[3].Err != errUnknownBatchOp {
+		t.Errorf("unknown op error = %v", ret.Items[3].Err)
+	}
+
+	stop := client.Batch([]BatchOp{DeleteOp("b", "missing"), DeleteOp("b", "x"), DeleteOp("b", "y")}, &BatchOptions{Concurrency: 1, StopOnError: true})
+	if stop.Summary.Failed != 1 || stop.Summary.Skipped != 2 {
+		t.Errorf("StopOnError Summary = %+v", stop.Summary)
+	}
+}
+
+func TestClientStruct_Batch_replay(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		mu.Unlock()
+		switch {
+		case n > 1 && strings.Contains(r.URL.Path, "deleted"):
+			// 第一次请求已经删除了对象
+			w.WriteHeader(404)
+		case n == 1 && strings.Contains(r.URL.Path, "busy"):
+			w.WriteHeader(429)
+		case n == 1:
+			w.WriteHeader(503)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(201)
+			w.Write([]byte(`{"code_text": "ok"}`))
+		}
+	}))
+	defer server.Close()
+
+	ops := []BatchOp{
+		DeleteOp("b", "a/deleted.txt"),
+		MoveRenameOp("b", "a/moved.txt", "c", ""),
+		MoveRenameOp("b", "a/busy.txt", "c", ""),
+	}
+	ret := testClient(server.URL).Batch(ops, &BatchOptions{Retries: 2, RetryDelay: time.Millisecond})
+
+	if it := ret.Items[0]; !it.Ok || it.Attempts != 2 {
+		t.Errorf("retried delete of a deleted object should succeed, got %+v", it)
+	}
+	if it := ret.Items[1]; it.Ok || it.Attempts != 1 {
+		t.Errorf("move should not be replayed after 503, got %+v", it)
+	}
+	if it := ret.Items[2]; !it.Ok || it.Attempts != 2 {
+		t.Errorf("move should be retried after 429, got %+v", it)
+	}
+}
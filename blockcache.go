@@ -0,0 +1,347 @@
+package goharbor
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BlockCacheOptions 对象数据块缓存选项
+type BlockCacheOptions struct {
+	Dir       string // 缓存目录，不能为空
+	MaxBytes  int64  // 缓存数据的最大字节数，超出时淘汰最久未使用的数据块，<=0时为1Gb
+	BlockSize int    // 数据块大小，读取时按此大小对齐下载和缓存，<=0时为4Mb
+}
+
+// BlockCache 对象数据块的本地磁盘缓存，可被多个client共享
+// 数据块以 服务地址和访问密钥/桶/对象/偏移量 为键，对象的大小或修改时间变化时，该对象的全部数据块失效
+type BlockCache struct {
+	mu      sync.Mutex
+	opts    BlockCacheOptions
+	blocks  map[string]*list.Element
+	lru     *list.List
+	size    int64
+	version map[string]blockVersion // 对象键 -> 缓存数据所属的对象版本
+}
+
+// blockVersion 缓存数据所属的对象和对象版本
+type blockVersion struct {
+	bucketName string
+	pathName   string
+	version    string
+}
+
+// blockEntry 一个缓存的数据块
+type blockEntry struct {
+	Key        string `json:"key"`
+	Scope      string `json:"scope"` // 服务地址和访问密钥，见cacheScope
+	BucketName string `json:"bucket_name"`
+	PathName   string `json:"path_name"`
+	Offset     int64  `json:"offset"`
+	Size       int64  `json:"size"`
+	Version    string `json:"version"`
+}
+
+// InitBlockCache 初始化一个数据块缓存，并加载缓存目录中已有的数据块
+func InitBlockCache(opts BlockCacheOptions) (*BlockCache, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("BlockCacheOptions.Dir can not be empty")
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 1024 * 1024 * 1024 //1Gb
+	}
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = 1024 * 1024 * 4 //4Mb
+	}
+	if err := os.MkdirAll(opts.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	bc := &BlockCache{
+		opts:    opts,
+		blocks:  make(map[string]*list.Element),
+		lru:     list.New(),
+		version: make(map[string]blockVersion),
+	}
+
+	names, err := filepath.Glob(filepath.Join(opts.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		e := &blockEntry{}
+		if err != nil || json.Unmarshal(data, e) != nil {
+			os.Remove(name)
+			continue
+		}
+		if fi, err := os.Stat(bc.dataPath(e.Key)); err != nil || fi.Size() != e.Size {
+			bc.removeFiles(e.Key)
+			continue
+		}
+		objKey := objectCacheKey(e.Scope, e.BucketName, e.PathName)
+		if v, ok := bc.version[objKey]; ok && v.version != e.Version {
+			bc.removeFiles(e.Key)
+			continue
+		}
+		bc.version[objKey] = blockVersion{bucketName: e.BucketName, pathName: e.PathName, version: e.Version}
+		bc.add(e)
+	}
+	bc.mu.Lock()
+	bc.evict()
+	bc.mu.Unlock()
+	return bc, nil
+}
+
+// Size 缓存数据的总字节数
+func (bc *BlockCache) Size() int64 {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.size
+}
+
+// Clear 清空缓存
+func (bc *BlockCache) Clear() {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	for _, elem := range bc.blocks {
+		bc.remove(elem)
+	}
+	bc.version = make(map[string]blockVersion)
+}
+
+// objectCacheKey 对象的缓存键
+// param scope: 服务地址和访问密钥，见cacheScope
+func objectCacheKey(scope, bucketName, pathName string) string {
+	return scope + "|" + bucketName + "|" + buildPath([]string{pathName})
+}
+
+func blockCacheKey(scope, bucketName, pathName string, offset int64) string {
+	return objectCacheKey(scope, bucketName, pathName) + "|" + strconv.FormatInt(offset, 10)
+}
+
+func (bc *BlockCache) filePath(key, ext string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(bc.opts.Dir, hex.EncodeToString(sum[:])+ext)
+}
+
+func (bc *BlockCache) dataPath(key string) string {
+	return bc.filePath(key, ".blk")
+}
+
+func (bc *BlockCache) removeFiles(key string) {
+	os.Remove(bc.dataPath(key))
+	os.Remove(bc.filePath(key, ".json"))
+}
+
+// add 加入一个数据块索引，调用者需持有锁（或在初始化期间）
+func (bc *BlockCache) add(e *blockEntry) {
+	if elem, ok := bc.blocks[e.Key]; ok {
+		bc.size -= elem.Value.(*blockEntry).Size
+		elem.Value = e
+		bc.lru.MoveToFront(elem)
+	} else {
+		bc.blocks[e.Key] = bc.lru.PushFront(e)
+	}
+	bc.size += e.Size
+}
+
+// remove 删除一个数据块，调用者需持有锁
+func (bc *BlockCache) remove(elem *list.Element) {
+	e := elem.Value.(*blockEntry)
+	bc.lru.Remove(elem)
+	delete(bc.blocks, e.Key)
+	bc.size -= e.Size
+	bc.removeFiles(e.Key)
+}
+
+// evict 淘汰最久未使用的数据块直到不超过容量，调用者需持有锁
+func (bc *BlockCache) evict() {
+	for bc.size > bc.opts.MaxBytes && bc.lru.Len() > 0 {
+		bc.remove(bc.lru.Back())
+	}
+}
+
+// validate 对象版本变化时删除该对象的全部数据块
+func (bc *BlockCache) validate(scope, bucketName, pathName, version string) {
+	objKey := objectCacheKey(scope, bucketName, pathName)
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if v, ok := bc.version[objKey]; ok && v.version == version {
+		return
+	}
+	bc.dropObject(objKey)
+	bc.version[objKey] = blockVersion{bucketName: bucketName, pathName: buildPath([]string{pathName}), version: version}
+}
+
+// invalidate 删除对象的全部数据块，不区分服务地址和访问密钥：同一服务的其他访问密钥缓存的同一对象也已变化
+func (bc *BlockCache) invalidate(bucketName, pathName string) {
+	if bc == nil {
+		return
+	}
+	pathName = buildPath([]string{pathName})
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	for objKey, v := range bc.version {
+		if v.bucketName == bucketName && v.pathName == pathName {
+			bc.dropObject(objKey)
+			delete(bc.version, objKey)
+		}
+	}
+}
+
+// dropObject 删除对象的全部数据块，调用者需持有锁
+func (bc *BlockCache) dropObject(objKey string) {
+	for key, elem := range bc.blocks {
+		if strings.HasPrefix(key, objKey+"|") {
+			bc.remove(elem)
+		}
+	}
+}
+
+// get 获取一个数据块
+func (bc *BlockCache) get(scope, bucketName, pathName string, offset int64) ([]byte, bool) {
+	key := blockCacheKey(scope, bucketName, pathName, offset)
+
+	bc.mu.Lock()
+	elem, ok := bc.blocks[key]
+	if ok {
+		bc.lru.MoveToFront(elem)
+	}
+	bc.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadFile(bc.dataPath(key))
+	if err != nil || int64(len(data)) != elem.Value.(*blockEntry).Size {
+		return nil, false
+	}
+	return data, true
+}
+
+// put 缓存一个数据块
+func (bc *BlockCache) put(scope, bucketName, pathName string, offset int64, version string, data []byte) {
+	key := blockCacheKey(scope, bucketName, pathName, offset)
+	e := &blockEntry{
+		Key:        key,
+		Scope:      scope,
+		BucketName: bucketName,
+		PathName:   buildPath([]string{pathName}),
+		Offset:     offset,
+		Size:       int64(len(data)),
+		Version:    version,
+	}
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if bc.version[objectCacheKey(scope, bucketName, pathName)].version != version {
+		return
+	}
+	if ioutil.WriteFile(bc.dataPath(key), data, 0600) != nil {
+		return
+	}
+	if ioutil.WriteFile(bc.filePath(key, ".json"), meta, 0600) != nil {
+		os.Remove(bc.dataPath(key))
+		return
+	}
+	bc.add(e)
+	bc.evict()
+}
+
+// downloadVersion 一次下载中数据块缓存使用的对象版本，version为空时需获取对象元数据
+type downloadVersion struct {
+	size    int64
+	version string
+}
+
+// cachedDownloadOneChunk 通过数据块缓存下载一个对象数据块
+// 按缓存的数据块大小对齐，缺失的数据块从服务器下载并缓存
+// param dv: 同一次下载共用的对象版本，nil时每次获取对象元数据
+func (client ClientStruct) cachedDownloadOneChunk(bucketName, objPathName string, offset int64, size int, dv *downloadVersion) (*ChunkReturn, error) {
+	bc := client.API.configs.BlockCache
+	scope := cacheScope(&client.API.configs)
+
+	if dv == nil {
+		dv = &downloadVersion{}
+	}
+	if dv.version == "" {
+		meta, err := client.GetMetadata(bucketName, objPathName)
+		if err != nil {
+			return nil, err
+		}
+		if !meta.Ok || !meta.Obj.FileOrDir {
+			return client.downloadOneChunk(bucketName, objPathName, offset, size)
+		}
+		dv.size = int64(meta.Obj.Size)
+		dv.version = strconv.FormatUint(meta.Obj.Size, 10) + "|" + meta.Obj.UpdateTime
+		bc.validate(scope, bucketName, objPathName, dv.version)
+	}
+	objSize, version := dv.size, dv.version
+	if offset < 0 || offset >= objSize || size <= 0 {
+		return client.downloadOneChunk(bucketName, objPathName, offset, size)
+	}
+
+	end := offset + int64(size)
+	if end > objSize {
+		end = objSize
+	}
+	blockSize := int64(bc.opts.BlockSize)
+	chunk := make([]byte, 0, end-offset)
+	for start := offset / blockSize * blockSize; start < end; start += blockSize {
+		block, ok := bc.get(scope, bucketName, objPathName, start)
+		if !ok {
+			r, err := client.downloadOneChunk(bucketName, objPathName, start, bc.opts.BlockSize)
+			if err != nil {
+				return nil, err
+			}
+			if !r.Ok {
+				return r, nil
+			}
+			if r.ObjSize != objSize {
+				// 对象已被修改，元数据尚未更新
+				bc.invalidate(bucketName, objPathName)
+				*dv = downloadVersion{}
+				return client.downloadOneChunk(bucketName, objPathName, offset, size)
+			}
+			block = r.Chunk
+			bc.put(scope, bucketName, objPathName, start, version, block)
+		}
+
+		from, to := int64(0), int64(len(block))
+		if start < offset {
+			from = offset - start
+		}
+		if start+to > end {
+			to = end - start
+		}
+		if from >= to {
+			break
+		}
+		chunk = append(chunk, block[from:to]...)
+	}
+
+	cr := &ChunkReturn{}
+	cr.Ok = true
+	cr.Code = 200
+	cr.CodeText = "Download successfull"
+	cr.ChunkOffset = offset
+	cr.ChunkSize = int64(len(chunk))
+	cr.ObjSize = objSize
+	cr.Chunk = chunk
+	return cr, nil
+}
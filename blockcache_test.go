@@ -0,0 +1,173 @@
+package goharbor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"goharbor/grequests"
+)
+
+func TestBlockCache_DownloadOneChunk(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 10))
+	updateTime := "2019-05-01 08:00:00"
+	var chunkRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/metadata/") {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"obj": {"na": "x.bin", "name": "x.bin", "fod": true, "si": %d, "upt": %q}}`, len(content), updateTime)
+			return
+		}
+		atomic.AddInt32(&chunkRequests, 1)
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		if offset+size > len(content) {
+			size = len(content) - offset
+		}
+		w.Header().Set("evob_chunk_size", strconv.Itoa(size))
+		w.Header().Set("evob_obj_size", strconv.Itoa(len(content)))
+		w.Write(content[offset : offset+size])
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "goharbor-blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bc, err := InitBlockCache(BlockCacheOptions{Dir: dir, BlockSize: 16, MaxBytes: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := testClient(server.URL).WithBlockCache(bc)
+
+	read := func(offset int64, size int) string {
+		r, err := client.DownloadOneChunk("b", "x.bin", offset, size)
+		if err != nil || !r.Ok {
+			t.Fatalf("DownloadOneChunk() = %+v, %v", r, err)
+		}
+		return string(r.Chunk)
+	}
+
+	if got := read(10, 20); got != string(content[10:30]) {
+		t.Errorf("read = %q", got)
+	}
+	if n := atomic.LoadInt32(&chunkRequests); n != 2 {
+		t.Errorf("chunk requests = %d, want 2", n)
+	}
+	if got := read(12, 18); got != string(content[12:30]) {
+		t.Errorf("cached read = %q", got)
+	}
+	if n := atomic.LoadInt32(&chunkRequests); n != 2 {
+		t.Errorf("cached read should not request server, requests = %d", n)
+	}
+	if got := read(90, 50); got != string(content[90:]) {
+		t.Errorf("tail read = %q", got)
+	}
+	if bc.Size() > 64 {
+		t.Errorf("cache size %d exceeds MaxBytes", bc.Size())
+	}
+
+	// 对象修改时间变化后，缓存失效
+	updateTime = "2019-05-02 08:00:00"
+	read(12, 18)
+	if n := atomic.LoadInt32(&chunkRequests); n != 6 {
+		t.Errorf("stale blocks should be refetched, requests = %d", n)
+	}
+
+}
+
+func TestBlockCache_scope(t *testing.T) {
+	s1, s2 := newMemObjectServer(), newMemObjectServer()
+	defer s1.Close()
+	defer s2.Close()
+	s1.set("b/x", []byte("aaaa"))
+	s2.set("b/x", []byte("bbbb"))
+
+	dir, err := ioutil.TempDir("", "goharbor-blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bc, err := InitBlockCache(BlockCacheOptions{Dir: dir, BlockSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(client ClientStruct) string {
+		r, err := client.WithBlockCache(bc).DownloadOneChunk("b", "x", 0, 4)
+		if err != nil || !r.Ok {
+			t.Fatalf("DownloadOneChunk() = %+v, %v", r, err)
+		}
+		return string(r.Chunk)
+	}
+
+	// 不同服务的同名桶和对象不共享数据块
+	if got := read(s1.client()); got != "aaaa" {
+		t.Errorf("read = %q", got)
+	}
+	if got := read(s2.client()); got != "bbbb" {
+		t.Errorf("read from another host = %q", got)
+	}
+
+	// 同一服务的不同访问密钥不共享数据块
+	var chunkRequests int32
+	other := s1.client().WithMiddleware(countRequests("/api/v1/obj/", &chunkRequests))
+	other.API.configs.Accesskey = "777777"
+	read(other)
+	if n := atomic.LoadInt32(&chunkRequests); n != 1 {
+		t.Errorf("another access key should not read cached blocks, requests = %d", n)
+	}
+}
+
+func TestBlockCache_DownLoadObject(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	content := []byte(strings.Repeat("x", 12*1024*1024))
+	server.set("b/x.bin", content)
+
+	dir, err := ioutil.TempDir("", "goharbor-blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bc, err := InitBlockCache(BlockCacheOptions{Dir: filepath.Join(dir, "blocks"), BlockSize: 1024 * 1024, MaxBytes: 64 * 1024 * 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 一次下载只获取一次对象元数据
+	var metaRequests int32
+	client := server.client().WithBlockCache(bc).WithMiddleware(countRequests("/api/v1/metadata/", &metaRequests))
+	r, err := client.DownLoadObject("b", "x.bin", dir, "x.bin", 0)
+	if err != nil || !r.Ok {
+		t.Fatalf("DownLoadObject() = %+v, %v", r, err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "x.bin")); !bytes.Equal(data, content) {
+		t.Error("downloaded data mismatch")
+	}
+	if n := atomic.LoadInt32(&metaRequests); n != 1 {
+		t.Errorf("metadata requests = %d, want 1", n)
+	}
+}
+
+// countRequests 统计URL包含path的GET请求数的中间件
+func countRequests(path string, n *int32) Middleware {
+	return func(next Handler) Handler {
+		return func(req *APIRequest) (*grequests.Response, error) {
+			if req.Method == "GET" && strings.Contains(req.URL, path) {
+				atomic.AddInt32(n, 1)
+			}
+			return next(req)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package goharbor
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheOptions 元数据和目录列表缓存选项
+type CacheOptions struct {
+	TTL        time.Duration // 缓存有效期，<=0时为1分钟
+	MaxEntries int           // 最大缓存条目数，超出时淘汰最久未使用的条目，<=0时为10000
+	Dir        string        // 磁盘缓存目录，""为仅使用内存缓存
+}
+
+// MetadataCache 元数据和目录列表缓存，可被多个client共享
+// 缓存按服务地址和访问密钥区分，访问不同服务或使用不同访问密钥的client不会读到彼此的缓存；
+// 共享缓存的client上传、删除、移动对象或创建删除目录时，自动使相关缓存失效
+type MetadataCache struct {
+	mu      sync.Mutex
+	opts    CacheOptions
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// cacheEntry 一个缓存条目
+type cacheEntry struct {
+	Key        string          `json:"key"`
+	BucketName string          `json:"bucket_name"`
+	PathName   string          `json:"path_name"` // 元数据的全路径或列表所属的全路径目录名
+	List       bool            `json:"list"`      // 目录列表（true），元数据（false）
+	Expires    time.Time       `json:"expires"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// InitMetadataCache 初始化一个元数据缓存，配置了磁盘缓存目录时加载其中未过期的条目
+func InitMetadataCache(opts CacheOptions) (*MetadataCache, error) {
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 10000
+	}
+
+	c := &MetadataCache{
+		opts:    opts,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	if opts.Dir == "" {
+		return c, nil
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0700); err != nil {
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(opts.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		e := &cacheEntry{}
+		if json.Unmarshal(data, e) != nil || now.After(e.Expires) {
+			os.Remove(name)
+			continue
+		}
+		c.put(e)
+	}
+	return c, nil
+}
+
+// Clear 清空缓存
+func (c *MetadataCache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, elem := range c.entries {
+		c.remove(key, elem)
+	}
+}
+
+// Len 缓存条目数
+func (c *MetadataCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// cacheScope 缓存条目所属的服务地址和访问密钥，不同服务的同名桶、不同访问密钥（权限可能不同）不共享缓存
+func cacheScope(configs *ConfigStruct) string {
+	host := configs.Host
+	if configs.Endpoints != nil {
+		host = strings.Join(configs.Endpoints.Hosts(), ",")
+	}
+	return configs.Scheme + "://" + host + "|" + configs.Accesskey
+}
+
+func metadataCacheKey(scope, bucketName, pathName string) string {
+	return "m|" + scope + "|" + bucketName + "|" + buildPath([]string{pathName})
+}
+
+func listCacheKey(scope, bucketName, dirPathName string, offset, limit int) string {
+	return "l|" + scope + "|" + bucketName + "|" + buildPath([]string{dirPathName}) + "|" + strconv.Itoa(offset) + "|" + strconv.Itoa(limit)
+}
+
+func listURLCacheKey(scope, url string) string {
+	return "u|" + scope + "|" + url
+}
+
+// get 获取缓存并解码到v
+func (c *MetadataCache) get(key string, v interface{}) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	e := elem.Value.(*cacheEntry)
+	if time.Now().After(e.Expires) {
+		c.remove(key, elem)
+		return false
+	}
+	if json.Unmarshal(e.Data, v) != nil {
+		c.remove(key, elem)
+		return false
+	}
+	c.lru.MoveToFront(elem)
+	return true
+}
+
+// set 缓存v
+func (c *MetadataCache) set(key, bucketName, pathName string, isList bool, v interface{}) {
+	if c == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	e := &cacheEntry{
+		Key:        key,
+		BucketName: bucketName,
+		PathName:   buildPath([]string{pathName}),
+		List:       isList,
+		Expires:    time.Now().Add(c.opts.TTL),
+		Data:       data,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(e)
+	if c.opts.Dir != "" {
+		if b, err := json.Marshal(e); err == nil {
+			ioutil.WriteFile(c.diskPath(key), b, 0600)
+		}
+	}
+}
+
+// put 加入一个条目并淘汰超出的条目，调用者需持有锁
+func (c *MetadataCache) put(e *cacheEntry) {
+	if elem, ok := c.entries[e.Key]; ok {
+		elem.Value = e
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[e.Key] = c.lru.PushFront(e)
+	}
+	for c.lru.Len() > c.opts.MaxEntries {
+		elem := c.lru.Back()
+		c.remove(elem.Value.(*cacheEntry).Key, elem)
+	}
+}
+
+// remove 删除一个条目，调用者需持有锁
+func (c *MetadataCache) remove(key string, elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, key)
+	if c.opts.Dir != "" {
+		os.Remove(c.diskPath(key))
+	}
+}
+
+func (c *MetadataCache) diskPath(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(c.opts.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// invalidatePath 对象或目录发生变化，使其元数据及其父目录的列表缓存失效
+func (c *MetadataCache) invalidatePath(bucketName, pathName string) {
+	c.invalidate(bucketName, pathName, false)
+}
+
+// invalidateTree 目录树发生变化，使目录及其下全部元数据和列表缓存失效，以及其父目录的列表缓存
+func (c *MetadataCache) invalidateTree(bucketName, dirPathName string) {
+	c.invalidate(bucketName, dirPathName, true)
+}
+
+// invalidate 使缓存失效，不区分服务地址和访问密钥：同一服务的其他访问密钥缓存的同一对象也已变化
+func (c *MetadataCache) invalidate(bucketName, pathName string, tree bool) {
+	if c == nil {
+		return
+	}
+	pathName = buildPath([]string{pathName})
+	parent, _ := CutPathAndName(pathName)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, elem := range c.entries {
+		e := elem.Value.(*cacheEntry)
+		if e.BucketName != bucketName {
+			continue
+		}
+		switch {
+		case e.PathName == pathName:
+		case e.List && e.PathName == parent:
+		case tree && (pathName == "" || strings.HasPrefix(e.PathName, pathName+"/")):
+		default:
+			continue
+		}
+		c.remove(key, elem)
+	}
+}
@@ -0,0 +1,103 @@
+package goharbor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMetadataCache(t *testing.T) {
+	c, _ := InitMetadataCache(CacheOptions{MaxEntries: 3})
+
+	obj := ObjMetadataReturn{BucketName: "b", Obj: MetadataStruct{Name: "x.txt", Size: 10}}
+	obj.Ok = true
+	c.set(metadataCacheKey("", "b", "a/x.txt"), "b", "a/x.txt", false, obj)
+	c.set(listCacheKey("", "b", "a", 0, 0), "b", "a", true, ListDirReturn{Count: 1})
+	c.set(listCacheKey("", "b", "a/sub", 0, 0), "b", "a/sub", true, ListDirReturn{Count: 2})
+
+	got := ObjMetadataReturn{}
+	if !c.get(metadataCacheKey("", "b", "/a/x.txt/"), &got) || got.Obj.Size != 10 || !got.Ok {
+		t.Fatalf("cached metadata = %+v", got)
+	}
+
+	// 对象变化使其元数据和父目录列表失效，不影响其他目录
+	c.invalidatePath("b", "a/x.txt")
+	if c.Len() != 1 {
+		t.Errorf("Len() after invalidatePath = %v, want 1", c.Len())
+	}
+
+	c.set(listCacheKey("", "b", "a", 0, 0), "b", "a", true, ListDirReturn{Count: 1})
+	c.invalidateTree("b", "a")
+	if c.Len() != 0 {
+		t.Errorf("Len() after invalidateTree = %v, want 0", c.Len())
+	}
+
+	// 超出容量时淘汰最久未使用的条目
+	for _, p := range []string{"1", "2", "3"} {
+		c.set(metadataCacheKey("", "b", p), "b", p, false, obj)
+	}
+	c.get(metadataCacheKey("", "b", "1"), &got)
+	c.set(metadataCacheKey("", "b", "4"), "b", "4", false, obj)
+	if c.get(metadataCacheKey("", "b", "2"), &got) {
+		t.Error("least recently used entry should be evicted")
+	}
+	if !c.get(metadataCacheKey("", "b", "1"), &got) {
+		t.Error("recently used entry should be kept")
+	}
+}
+
+func TestMetadataCache_disk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goharbor-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := InitMetadataCache(CacheOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.set(metadataCacheKey("", "b", "x"), "b", "x", false, ObjMetadataReturn{BucketName: "b"})
+
+	c2, err := InitMetadataCache(CacheOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ObjMetadataReturn{}
+	if !c2.get(metadataCacheKey("", "b", "x"), &got) || got.BucketName != "b" {
+		t.Errorf("disk cache not loaded: %+v", got)
+	}
+	c2.invalidatePath("b", "x")
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("invalidated entry should be removed from disk, %d files left", len(files))
+	}
+}
+
+func TestMetadataCache_scope(t *testing.T) {
+	s1, s2 := newMemObjectServer(), newMemObjectServer()
+	defer s1.Close()
+	defer s2.Close()
+	s1.set("b/x", []byte("aaa"))
+	s2.set("b/x", []byte("bbbbbb"))
+
+	// 不同服务的同名桶和对象不共享缓存
+	c, _ := InitMetadataCache(CacheOptions{})
+	c1, c2 := s1.client().WithCache(c), s2.client().WithCache(c)
+	if r, err := c1.GetMetadata("b", "x"); err != nil || r.Obj.Size != 3 {
+		t.Fatalf("GetMetadata() = %+v, %v", r, err)
+	}
+	if r, err := c2.GetMetadata("b", "x"); err != nil || r.Obj.Size != 6 {
+		t.Errorf("GetMetadata() on another host = %+v, %v", r, err)
+	}
+
+	// 同一服务的不同访问密钥不共享缓存
+	s1.set("b/x", []byte("aaaa"))
+	other := s1.client().WithCache(c)
+	other.API.configs.Accesskey = "777777"
+	if r, err := other.GetMetadata("b", "x"); err != nil || r.Obj.Size != 4 {
+		t.Errorf("GetMetadata() with another access key = %+v, %v", r, err)
+	}
+	if r, _ := c1.GetMetadata("b", "x"); r.Obj.Size != 3 {
+		t.Errorf("cached metadata = %+v", r)
+	}
+}
@@ -0,0 +1,105 @@
+package goharbor
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"goharbor/grequests"
+)
+
+// clockSkew 服务器与本地的时钟偏差（服务器时间-本地时间），单位为秒s
+// 同一个client的各个副本共享同一个clockSkew
+type clockSkew struct {
+	offset int64
+}
+
+// get 获取时钟偏差
+func (cs *clockSkew) get() time.Duration {
+	if cs == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&cs.offset)) * time.Second
+}
+
+// seconds 获取时钟偏差秒数
+func (cs *clockSkew) seconds() int64 {
+	if cs == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&cs.offset)
+}
+
+// update 根据响应的Date头更新时钟偏差
+// return: 偏差是否发生了变化
+func (cs *clockSkew) update(resp *grequests.Response, now time.Time) bool {
+	if cs == nil || resp == nil || resp.Header == nil {
+		return false
+	}
+
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return false
+	}
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return false
+	}
+
+	offset := serverTime.Unix() - now.Unix()
+	// Date头精度为秒，忽略网络延迟带来的1秒误差
+	if offset >= -1 && offset <= 1 {
+		offset = 0
+	}
+	return atomic.SwapInt64(&cs.offset, offset) != offset
+}
+
+// signatureDeadline 计算访问密钥签名的截止时间戳
+func signatureDeadline(configs ConfigStruct, now time.Time) int64 {
+	ttl := configs.SignatureTTL
+	if ttl <= 0 {
+		ttl = DefaultSignatureTTL
+	}
+	return now.Unix() + configs.clockSkew.seconds() + ttl
+}
+
+// isSignatureExpired 响应是否为访问密钥签名过期
+func isSignatureExpired(resp *grequests.Response) bool {
+	if resp == nil || (resp.StatusCode != 401 && resp.StatusCode != 403) {
+		return false
+	}
+
+	result := ResponseResult(resp)
+	text := strings.ToLower(result.CodeText)
+	if text == "" {
+		text = strings.ToLower(resp.String())
+	}
+	return strings.Contains(text, "expire") || strings.Contains(text, "过期")
+}
+
+// rewindRequestOptions 将请求体重置到起始位置，以便重新发送请求
+// return: 请求体是否可以重新发送
+func rewindRequestOptions(ro *grequests.RequestOptions) bool {
+	if ro.RequestBody != nil {
+		s, ok := ro.RequestBody.(io.Seeker)
+		if !ok {
+			return false
+		}
+		if _, err := s.Seek(0, io.SeekStart); err != nil {
+			return false
+		}
+	}
+
+	for _, f := range ro.Files {
+		s, ok := f.FileContents.(io.Seeker)
+		if !ok {
+			return false
+		}
+		if _, err := s.Seek(0, io.SeekStart); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package goharbor
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"goharbor/grequests"
+)
+
+func Test_clockSkew_update(t *testing.T) {
+	now := time.Date(2019, 5, 1, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		date string
+		want time.Duration
+	}{
+		{name: "ahead", date: now.Add(10 * time.Minute).Format(http.TimeFormat), want: 10 * time.Minute},
+		{name: "behind", date: now.Add(-90 * time.Second).Format(http.TimeFormat), want: -90 * time.Second},
+		{name: "within error", date: now.Add(time.Second).Format(http.TimeFormat), want: 0},
+		{name: "invalid", date: "not a date", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := &clockSkew{}
+			resp := &grequests.Response{Header: http.Header{"Date": []string{tt.date}}}
+			cs.update(resp, now)
+			if got := cs.get(); got != tt.want {
+				t.Errorf("clockSkew.get() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_signatureDeadline(t *testing.T) {
+	now := time.Unix(1000, 0)
+	configs := ConfigStruct{SignatureTTL: 60, clockSkew: &clockSkew{offset: -30}}
+	if got := signatureDeadline(configs, now); got != 1030 {
+		t.Errorf("signatureDeadline() = %v, want %v", got, 1030)
+	}
+
+	configs = ConfigStruct{}
+	if got := signatureDeadline(configs, now); got != 1000+DefaultSignatureTTL {
+		t.Errorf("signatureDeadline() = %v, want %v", got, 1000+DefaultSignatureTTL)
+	}
+}
@@ -0,0 +1,269 @@
+package goharbor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Codec 客户端压缩编码
+// 压缩上传的对象名称加上编码的后缀，数据以压缩标记和编码名称开始，下载时只解压有压缩标记的对象；
+// zstd等第三方编码可以实现此接口后通过RegisterCodec注册
+type Codec interface {
+	Name() string   // 编码名称，如 "gzip"，不超过255字节
+	Suffix() string // 对象名称后缀，如 ".gz"
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// gzipCodec gzip编码
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string   { return "gzip" }
+func (gzipCodec) Suffix() string { return ".gz" }
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// Gzip 内置的gzip编码
+var Gzip Codec = gzipCodec{}
+
+// errCompressionOffset 压缩后的偏移量与文件偏移量不对应，不能续传
+var errCompressionOffset = errors.New("配置了Compression时不支持断点续传，startOffset必须为0")
+
+// compressMagic 客户端压缩上传的对象数据开头的标记，之后是编码名称的长度（1字节）和编码名称；
+// 名称有编码后缀但没有此标记的对象（如直接上传的.gz文件）下载时按原样读取
+const compressMagic = "EVZ1"
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{"gzip": Gzip}
+)
+
+// RegisterCodec 注册一个压缩编码，同名的编码被替换
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// GetCodec 按名称获取已注册的压缩编码
+func GetCodec(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[name]
+	return codec, ok
+}
+
+// compressedName 压缩对象的名称，已有编码后缀时不变
+func compressedName(codec Codec, objPathName string) string {
+	if strings.HasSuffix(objPathName, codec.Suffix()) {
+		return objPathName
+	}
+	return objPathName + codec.Suffix()
+}
+
+// compressReader 返回读取reader压缩后数据的流，以压缩标记和编码名称开始
+func compressReader(codec Codec, reader io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		name := codec.Name()
+		if len(name) > 255 {
+			pw.CloseWithError(errors.New("压缩编码名称不能超过255字节"))
+			return
+		}
+		header := append([]byte(compressMagic), byte(len(name)))
+		_, err := pw.Write(append(header, name...))
+		var cw io.WriteCloser
+		if err == nil {
+			cw, err = codec.NewWriter(pw)
+		}
+		if err == nil {
+			_, err = io.Copy(cw, reader)
+			if e := cw.Close(); err == nil {
+				err = e
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// readCompressHeader 读取数据开头的压缩标记，返回标记的编码；没有标记时返回nil且不消耗数据
+func readCompressHeader(r *bufio.Reader) (Codec, error) {
+	n := len(compressMagic)
+	head, err := r.Peek(n + 1)
+	if err == io.EOF || (err == nil && string(head[:n]) != compressMagic) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	full, err := r.Peek(n + 1 + int(head[n]))
+	if err == io.EOF {
+		return nil, errors.New("压缩对象的标记不完整")
+	}
+	if err != nil {
+		return nil, err
+	}
+	name := string(full[n+1:])
+	codec, ok := GetCodec(name)
+	if !ok {
+		return nil, fmt.Errorf("对象使用了未注册的压缩编码 %q", name)
+	}
+	_, err = r.Discard(len(full))
+	return codec, err
+}
+
+// bufferedReader 预读了数据的对象流
+type bufferedReader struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// decompressReader 解压流，关闭时同时关闭底层的对象流
+type decompressReader struct {
+	io.ReadCloser
+	raw io.Closer
+}
+
+func (r decompressReader) Close() error {
+	err := r.ReadCloser.Close()
+	if e := r.raw.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// WithCompression 返回一个上传时客户端压缩、下载时透明解压的client副本
+// param codec: 压缩编码，如 Gzip；nil为不压缩
+func (client ClientStruct) WithCompression(codec Codec) ClientStruct {
+	client.API.configs.Compression = codec
+	return client
+}
+
+// openObject 打开对象，返回读取流、实际打开的对象名称和解压使用的编码（未解压时为nil）
+// 配置了Compression时优先打开加上后缀的压缩对象，不存在时打开原对象；有压缩标记的对象按标记的编码解压
+func (client ClientStruct) openObject(bucketName, objPathName string) (io.ReadCloser, string, Codec, error) {
+	codec := client.API.configs.Compression
+	name := objPathName
+	if codec != nil {
+		name = compressedName(codec, objPathName)
+	}
+	r, err := client.openObjectReader(bucketName, name)
+	if err != nil {
+		if res, ok := err.(Results); !ok || res.Code != 404 || name == objPathName {
+			return nil, "", nil, err
+		}
+		// 未压缩上传的对象
+		name = objPathName
+		if r, err = client.openObjectReader(bucketName, name); err != nil {
+			return nil, "", nil, err
+		}
+	}
+	if codec == nil {
+		return r, name, nil, nil
+	}
+
+	br := bufio.NewReader(r)
+	if codec, err = readCompressHeader(br); err != nil {
+		r.Close()
+		return nil, "", nil, err
+	}
+	if codec == nil {
+		return bufferedReader{Reader: br, Closer: r}, name, nil, nil
+	}
+	dr, err := codec.NewReader(br)
+	if err != nil {
+		r.Close()
+		return nil, "", nil, err
+	}
+	return decompressReader{ReadCloser: dr, raw: r}, name, codec, nil
+}
+
+// uploadCompressedFile 压缩上传一个文件，压缩后的偏移量与文件偏移量不对应，因此总是从头上传
+func (client ClientStruct) uploadCompressedFile(bucketName, objPathName, fileName string) (*ObjReturn, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return client.uploadReader(bucketName, objPathName, file)
+}
+
+// downloadDecompressed 下载并解压一个对象到文件，总是从头下载
+// 返回的Offset和ObjSize为解压后的大小
+// param saveFilename: 保存的文件名，""时为对象名称，解压的对象去掉编码后缀
+func (client ClientStruct) downloadDecompressed(bucketName, objPathName, dirPath, saveFilename string) (*ObjReturn, error) {
+	rc, name, codec, err := client.openObject(bucketName, objPathName)
+	if err != nil {
+		if res, ok := err.(Results); ok {
+			return &ObjReturn{Results: res, ObjSize: -1}, nil
+		}
+		return nil, err
+	}
+	defer rc.Close()
+
+	if saveFilename == "" {
+		saveFilename = decompressedFilename(objPathName, codec)
+	}
+	saveFile, err := os.Create(filepath.Join(dirPath, saveFilename))
+	if err != nil {
+		return nil, err
+	}
+	defer saveFile.Close()
+
+	ret := &ObjReturn{ObjSize: -1}
+	var retErr error
+	pt := newProgressTracker(client.GetConfigs(), false, bucketName, name, 0, -1)
+	pt.start()
+	buf := make([]byte, 1024*1024)
+	for {
+		n, err := rc.Read(buf)
+		if n > 0 {
+			if _, e := saveFile.Write(buf[:n]); e != nil {
+				retErr = e
+				break
+			}
+			pt.chunkDone(ret.Offset, int64(n))
+			ret.Offset += int64(n)
+		}
+		if err == io.EOF {
+			ret.ObjSize = ret.Offset
+			pt.setTotal(ret.ObjSize)
+			ret.CodeText = "download ok"
+			ret.Ok = true
+			break
+		}
+		if err != nil {
+			if res, ok := err.(Results); ok {
+				ret.Results = res
+			} else {
+				retErr = err
+			}
+			break
+		}
+	}
+	pt.finish(ret.Ok, progressErr(ret, retErr))
+	return ret, retErr
+}
+
+// decompressedFilename 解压保存的文件名，去掉编码后缀；codec为nil（对象未解压）时不变
+func decompressedFilename(objPathName string, codec Codec) string {
+	_, name := filepath.Split(objPathName)
+	if codec != nil && len(name) > len(codec.Suffix()) {
+		name = strings.TrimSuffix(name, codec.Suffix())
+	}
+	return name
+}
@@ -0,0 +1,140 @@
+package goharbor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	plain := server.client()
+	client := plain.WithCompression(Gzip)
+
+	dir := t.TempDir()
+	content := []byte(strings.Repeat("time,level,msg\n2020-10-18,info,hello\n", 1000))
+	file := filepath.Join(dir, "log.csv")
+	ioutil.WriteFile(file, content, 0644)
+
+	// 压缩上传，对象名称加上编码后缀
+	ret, err := client.UploadObject("b", "logs/log.csv", file, 0)
+	if err != nil || !ret.IsDone() {
+		t.Fatalf("UploadObject() = %+v, %v", ret, err)
+	}
+	stored, ok := server.get("b/logs/log.csv.gz")
+	if !ok || len(stored) >= len(content) {
+		t.Fatalf("compressed object = %d bytes, %v", len(stored), ok)
+	}
+	// 数据以压缩标记和编码名称开始
+	header := compressMagic + "\x04gzip"
+	if !bytes.HasPrefix(stored, []byte(header)) {
+		t.Fatalf("compressed object header = %q", stored[:len(header)])
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(stored[len(header):]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(zr); !bytes.Equal(data, content) {
+		t.Error("stored object is not gzip of the file")
+	}
+
+	// 按原名称下载时透明解压
+	ret, err = client.DownLoadObject("b", "logs/log.csv", filepath.Join(dir, "out"), "", 0)
+	if err != nil || !ret.IsDone() || ret.ObjSize != int64(len(content)) {
+		t.Fatalf("DownLoadObject() = %+v, %v", ret, err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "out", "log.csv")); !bytes.Equal(data, content) {
+		t.Error("downloaded file differs")
+	}
+	ret, _ = client.DownLoadObject("b", "logs/log.csv.gz", filepath.Join(dir, "out2"), "", 0)
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "out2", "log.csv")); !ret.Ok || !bytes.Equal(data, content) {
+		t.Errorf("DownLoadObject(.gz) = %+v", ret)
+	}
+
+	rc, err := client.OpenObject("b", "logs/log.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("OpenObject() = %d bytes, %v", len(data), err)
+	}
+
+	// 未压缩上传的对象原样读取
+	plain.UploadReader("b", "logs/raw.txt", strings.NewReader("raw data"))
+	rc, err = client.OpenObject("b", "logs/raw.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(rc); string(data) != "raw data" {
+		t.Errorf("OpenObject(raw) = %q", data)
+	}
+
+	// 直接上传的.gz文件没有压缩标记，按原样下载和读取
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(content)
+	zw.Close()
+	plain.UploadReader("b", "logs/archive.csv.gz", bytes.NewReader(gz.Bytes()))
+	ret, err = client.DownLoadObject("b", "logs/archive.csv.gz", filepath.Join(dir, "out3"), "", 0)
+	if err != nil || !ret.IsDone() {
+		t.Fatalf("DownLoadObject(unmarked .gz) = %+v, %v", ret, err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "out3", "archive.csv.gz")); !bytes.Equal(data, gz.Bytes()) {
+		t.Error("unmarked .gz object should be saved as is")
+	}
+	rc, _ = client.OpenObject("b", "logs/archive.csv.gz")
+	if data, _ := ioutil.ReadAll(rc); !bytes.Equal(data, gz.Bytes()) {
+		t.Error("unmarked .gz object should be read as is")
+	}
+
+	// 不配置压缩时不解压
+	rc, _ = plain.OpenObject("b", "logs/log.csv.gz")
+	if data, _ := ioutil.ReadAll(rc); !bytes.Equal(data, stored) {
+		t.Error("client without compression should read raw bytes")
+	}
+
+	// 覆盖上传更短的内容，不残留旧的压缩数据
+	ioutil.WriteFile(file, []byte("short"), 0644)
+	if ret, err := client.UploadObject("b", "logs/log.csv", file, 0); err != nil || !ret.IsDone() {
+		t.Fatalf("UploadObject(short) = %+v, %v", ret, err)
+	}
+	rc, _ = client.OpenObject("b", "logs/log.csv")
+	if data, err := ioutil.ReadAll(rc); err != nil || string(data) != "short" {
+		t.Errorf("OpenObject(short) = %q, %v", data, err)
+	}
+
+	// 压缩时不能续传
+	if _, err := client.UploadObject("b", "logs/log.csv", file, 2); err == nil {
+		t.Error("expected error for non-zero upload offset")
+	}
+	if _, err := client.DownLoadObject("b", "logs/log.csv", dir, "", 2); err == nil {
+		t.Error("expected error for non-zero download offset")
+	}
+
+	ret, _ = client.DownLoadObject("b", "logs/missing.csv", dir, "", 0)
+	if ret == nil || ret.Ok || ret.Code != 404 {
+		t.Errorf("DownLoadObject(missing) = %+v", ret)
+	}
+}
+
+func TestCompressionConfig(t *testing.T) {
+	configs, err := InitConfig(map[ConfigKeyType]string{ACCESSKEY: "a", SECRETKEY: "b", COMPRESSION: "gzip"})
+	if err != nil || configs.Compression != Gzip {
+		t.Errorf("InitConfig(gzip) = %v, %v", configs.Compression, err)
+	}
+	if _, err := InitConfig(map[ConfigKeyType]string{ACCESSKEY: "a", SECRETKEY: "b", COMPRESSION: "lz4"}); err == nil {
+		t.Error("unregistered codec should fail")
+	}
+	if name := decompressedFilename("a/b.csv.gz", Gzip); name != "b.csv" {
+		t.Errorf("decompressedFilename() = %s", name)
+	}
+	if name := decompressedFilename("a/b.csv.gz", nil); name != "b.csv.gz" {
+		t.Errorf("decompressedFilename(nil) = %s", name)
+	}
+}
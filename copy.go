@@ -0,0 +1,250 @@
+package goharbor
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// copyChunkSize 复制对象时每个数据块的大小
+const copyChunkSize = 1024 * 1024 * 5 //5Mb
+
+// CopyObject 复制一个对象，可跨桶复制，数据不经过本地磁盘
+// param srcBucketName: 源对象所在桶名称
+// param srcObjPathName: 源对象桶下全路径对象名称
+// param dstBucketName: 目标桶名称
+// param dstObjPathName: 目标桶下全路径对象名称
+// param startOffset: 从对象的此偏移量处开始复制，用于断点续传
+func (client ClientStruct) CopyObject(srcBucketName, srcObjPathName, dstBucketName, dstObjPathName string, startOffset int64) (*ObjReturn, error) {
+
+	return CopyObjectBetween(client, client, srcBucketName, srcObjPathName, dstBucketName, dstObjPathName, startOffset)
+}
+
+// CopyObjectBetween 在两个client（可以是不同的EVHarbor服务）之间复制一个对象
+// 分片下载源对象并直接分片上传到目标，数据不经过本地磁盘；
+// 复制完成后校验源对象在复制期间未被修改（大小和最后修改时间），并回读目标对象比较其与复制数据的md5；
+// 续传时已复制部分的数据从源对象重新读取计算md5，不重新上传；
+// 配置了Encryption的client按明文复制：从srcClient解密读取，由dstClient重新加密上传
+// param srcClient: 源对象所在服务的client
+// param dstClient: 目标服务的client
+// param srcBucketName: 源对象所在桶名称
+// param srcObjPathName: 源对象桶下全路径对象名称
+// param dstBucketName: 目标桶名称
+// param dstObjPathName: 目标桶下全路径对象名称
+// param startOffset: 从对象的此偏移量处开始复制，用于断点续传
+func CopyObjectBetween(srcClient, dstClient ClientStruct, srcBucketName, srcObjPathName, dstBucketName, dstObjPathName string, startOffset int64) (*ObjReturn, error) {
+
+	dstClient, span := dstClient.startSpan("CopyObject", "src_bucket", srcBucketName, "src_object", srcObjPathName,
+		"dst_bucket", dstBucketName, "dst_object", dstObjPathName, "start_offset", startOffset)
+	if span != nil {
+		srcClient = srcClient.WithSpan(span)
+	}
+	ret, err := copyObjectBetween(srcClient, dstClient, srcBucketName, srcObjPathName, dstBucketName, dstObjPathName, startOffset)
+	endObjSpan(span, ret, err)
+	return ret, err
+}
+
+// copyObjectBetween 在两个client之间复制一个对象
+func copyObjectBetween(srcClient, dstClient ClientStruct, srcBucketName, srcObjPathName, dstBucketName, dstObjPathName string, startOffset int64) (*ObjReturn, error) {
+	srcEnc := srcClient.API.configs.Encryption != nil
+	dstEnc := dstClient.API.configs.Encryption != nil
+	var offset int64
+	if startOffset > 0 {
+		offset = startOffset
+	}
+
+	src, err := srcClient.WithCache(nil).GetMetadata(srcBucketName, srcObjPathName)
+	if err != nil {
+		return nil, err
+	}
+	if !src.Ok {
+		return &ObjReturn{Results: src.Results, Offset: offset, ObjSize: -1}, nil
+	}
+	if !src.Obj.FileOrDir {
+		return nil, errors.New("源路径是一个目录，不是对象")
+	}
+
+	ret := &ObjReturn{ObjSize: int64(src.Obj.Size)}
+	if srcEnc {
+		size, complete, err := plainObjectSize(ret.ObjSize)
+		if err != nil {
+			return nil, err
+		}
+		if !complete {
+			return nil, fmt.Errorf("%w: object is truncated or its upload is incomplete", ErrObjectTampered)
+		}
+		ret.ObjSize = size
+	}
+	if offset > ret.ObjSize {
+		return nil, errors.New("offset超出了对象大小")
+	}
+
+	// 从头复制时删除已有的目标对象，分片上传不会截断对象；
+	// 断点续传时，目标对象应已至少上传到offset处
+	digest := md5.New()
+	if offset == 0 {
+		r, err := dstClient.resetObject(dstBucketName, dstObjPathName)
+		if err != nil {
+			return nil, err
+		}
+		if !r.Ok {
+			return &ObjReturn{Results: *r, ObjSize: -1}, nil
+		}
+	} else {
+		dst, err := dstClient.WithCache(nil).GetMetadata(dstBucketName, dstObjPathName)
+		if err != nil {
+			return nil, err
+		}
+		if !dst.Ok {
+			return nil, errors.New("目标对象不存在或其大小小于续传的offset")
+		}
+		dstSize := int64(dst.Obj.Size)
+		if dstEnc {
+			// 已上传的完整分段的明文大小
+			if dstSize, _, err = plainObjectSize(dstSize); err != nil {
+				return nil, err
+			}
+		}
+		if dstSize < offset {
+			return nil, errors.New("目标对象不存在或其大小小于续传的offset")
+		}
+		if err := hashObject(srcClient, digest, srcBucketName, srcObjPathName, 0, offset); err != nil {
+			if res, ok := err.(Results); ok {
+				return &ObjReturn{Results: res, Offset: offset, ObjSize: -1}, nil
+			}
+			return nil, err
+		}
+	}
+
+	var retErr error
+	var encKey *objectKey
+	var dv downloadVersion
+	pt := newProgressTracker(dstClient.GetConfigs(), true, dstBucketName, dstObjPathName, offset, ret.ObjSize)
+	pt.start()
+	for {
+		var chunk []byte
+		if offset < ret.ObjSize {
+			r, err := srcClient.downloadChunk(srcBucketName, srcObjPathName, offset, copyChunkSize, &dv)
+			if err != nil {
+				retErr = err
+				break
+			}
+			if !r.Ok {
+				ret.Results = r.Results
+				break
+			}
+			if r.ObjSize != ret.ObjSize {
+				retErr = errors.New("源对象在复制期间大小发生了变化")
+				break
+			}
+			chunk = r.Chunk
+			digest.Write(chunk)
+		}
+
+		// 空对象也需要上传一次以创建目标对象
+		r, err := dstClient.uploadChunk(dstBucketName, dstObjPathName, offset, chunk, &encKey)
+		if err != nil {
+			retErr = err
+			break
+		}
+		if !r.Ok {
+			ret.Results = *r
+			break
+		}
+		pt.chunkDone(offset, int64(len(chunk)))
+		offset += int64(len(chunk))
+		if offset >= ret.ObjSize {
+			ret.Ok = true
+			break
+		}
+	}
+	ret.Offset = offset
+
+	if ret.Ok && dstEnc {
+		r, err := dstClient.finishEncryptedUpload(dstBucketName, dstObjPathName, offset, &encKey)
+		if err != nil {
+			ret.Ok, retErr = false, err
+		} else if !r.Ok {
+			ret.Ok, ret.Results = false, *r
+		}
+	}
+	if ret.Ok {
+		sum := hex.EncodeToString(digest.Sum(nil))
+		retErr = verifyCopy(srcClient, dstClient, src.Obj, ret.ObjSize, sum, srcBucketName, srcObjPathName, dstBucketName, dstObjPathName)
+		if retErr != nil {
+			ret.Ok = false
+		} else {
+			ret.CodeText = "copy ok"
+		}
+	}
+	pt.finish(ret.Ok, progressErr(ret, retErr))
+	return ret, retErr
+}
+
+// verifyCopy 校验源对象在复制期间未被修改，且目标对象的内容与复制的数据一致
+// 元数据不经过缓存读取；元数据中没有内容摘要，回读目标对象计算md5
+// param size: 复制数据的大小
+// param sum: 复制数据的md5(hex)
+func verifyCopy(srcClient, dstClient ClientStruct, srcObj MetadataStruct, size int64, sum, srcBucketName, srcObjPathName, dstBucketName, dstObjPathName string) error {
+
+	srcClient = srcClient.WithCache(nil)
+	dstClient = dstClient.WithCache(nil)
+	src, err := srcClient.GetMetadata(srcBucketName, srcObjPathName)
+	if err != nil {
+		return err
+	}
+	if !src.Ok || src.Obj.Size != srcObj.Size || src.Obj.UpdateTime != srcObj.UpdateTime {
+		return errors.New("源对象在复制期间被修改")
+	}
+
+	dst, err := dstClient.GetMetadata(dstBucketName, dstObjPathName)
+	if err != nil {
+		return err
+	}
+	if !dst.Ok {
+		return dst.Results
+	}
+	dstSize := int64(dst.Obj.Size)
+	if dstClient.API.configs.Encryption != nil {
+		if dstSize, _, err = plainObjectSize(dstSize); err != nil {
+			return err
+		}
+	}
+	if dstSize != size {
+		return errors.New("目标对象大小与源对象不一致")
+	}
+	h := md5.New()
+	if err := hashObject(dstClient.WithBlockCache(nil), h, dstBucketName, dstObjPathName, 0, size); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != sum {
+		return errors.New("目标对象的md5与复制的数据不一致")
+	}
+	return nil
+}
+
+// hashObject 分片下载对象[offset, end)范围内的数据写入h，服务器返回失败时返回Results
+func hashObject(client ClientStruct, h hash.Hash, bucketName, objPathName string, offset, end int64) error {
+	var dv downloadVersion
+	for offset < end {
+		size := int64(copyChunkSize)
+		if end-offset < size {
+			size = end - offset
+		}
+		r, err := client.downloadChunk(bucketName, objPathName, offset, int(size), &dv)
+		if err != nil {
+			return err
+		}
+		if !r.Ok {
+			return r.Results
+		}
+		if len(r.Chunk) == 0 {
+			return errors.New("对象数据不足")
+		}
+		h.Write(r.Chunk)
+		offset += int64(len(r.Chunk))
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package goharbor
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"goharbor/grequests"
+)
+
+// beforeChunkGet 在第n次下载对象数据块之前调用fn的中间件
+func beforeChunkGet(n int, fn func()) Middleware {
+	var mu sync.Mutex
+	count := 0
+	return func(next Handler) Handler {
+		return func(req *APIRequest) (*grequests.Response, error) {
+			if req.Method == "GET" && strings.Contains(req.URL, "/api/v1/obj/") {
+				mu.Lock()
+				count++
+				if count == n {
+					fn()
+				}
+				mu.Unlock()
+			}
+			return next(req)
+		}
+	}
+}
+
+func TestCopyObjectBetween(t *testing.T) {
+	src, dst := newMemObjectServer(), newMemObjectServer()
+	defer src.Close()
+	defer dst.Close()
+	content := bytes.Repeat([]byte("0123456789"), copyChunkSize/10+100)
+	src.set("b/a/x.bin", content)
+
+	ret, err := CopyObjectBetween(src.client(), dst.client(), "b", "a/x.bin", "c", "copy/x.bin", 0)
+	if err != nil || !ret.IsDone() || ret.ObjSize != int64(len(content)) {
+		t.Fatalf("CopyObjectBetween() = %+v, %v", ret, err)
+	}
+	if data, _ := dst.get("c/copy/x.bin"); !bytes.Equal(data, content) {
+		t.Fatalf("copied %d bytes, want %d", len(data), len(content))
+	}
+
+	// 覆盖更大的已有目标对象，不残留旧数据
+	dst.set("c/copy/big.bin", append(bytes.Repeat([]byte("x"), len(content)), 'y'))
+	ret, err = CopyObjectBetween(src.client(), dst.client(), "b", "a/x.bin", "c", "copy/big.bin", 0)
+	if err != nil || !ret.IsDone() {
+		t.Fatalf("CopyObjectBetween() onto a larger object = %+v, %v", ret, err)
+	}
+	if data, _ := dst.get("c/copy/big.bin"); !bytes.Equal(data, content) {
+		t.Errorf("overwritten object is %d bytes, want %d", len(data), len(content))
+	}
+
+	// 同一服务内复制空对象
+	src.set("b/empty", []byte{})
+	if ret, err := src.client().CopyObject("b", "empty", "b", "empty2", 0); err != nil || !ret.IsDone() {
+		t.Fatalf("CopyObject(empty) = %+v, %v", ret, err)
+	}
+	if data, ok := src.get("b/empty2"); !ok || len(data) != 0 {
+		t.Errorf("empty copy = %q, %v", data, ok)
+	}
+
+	if ret, err := src.client().CopyObject("b", "missing", "b", "x", 0); err != nil || ret.Ok || ret.Code != 404 {
+		t.Errorf("CopyObject(missing) = %+v, %v", ret, err)
+	}
+}
+
+func TestCopyObjectResume(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	client := server.client()
+	content := bytes.Repeat([]byte("abcdefghij"), copyChunkSize/10+100)
+	server.set("b/src", content)
+
+	// 目标对象已复制了第一个数据块
+	server.set("b/dst", append([]byte(nil), content[:copyChunkSize]...))
+	uploads := server.uploads
+	ret, err := client.CopyObject("b", "src", "b", "dst", copyChunkSize)
+	if err != nil || !ret.IsDone() {
+		t.Fatalf("CopyObject(resume) = %+v, %v", ret, err)
+	}
+	if server.uploads != uploads+1 {
+		t.Errorf("resume uploaded %d chunks, want 1", server.uploads-uploads)
+	}
+	if data, _ := server.get("b/dst"); !bytes.Equal(data, content) {
+		t.Error("resumed copy differs from source")
+	}
+
+	// 已复制的部分与源对象不一致
+	bad := bytes.ToUpper(content[:copyChunkSize])
+	server.set("b/dst2", bad)
+	if ret, err := client.CopyObject("b", "src", "b", "dst2", copyChunkSize); err == nil || ret.Ok {
+		t.Errorf("CopyObject(corrupt prefix) = %+v, %v", ret, err)
+	}
+
+	if _, err := client.CopyObject("b", "src", "b", "none", copyChunkSize); err == nil {
+		t.Error("resume without destination object should fail")
+	}
+}
+
+func TestCopyObjectSourceModified(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	content := bytes.Repeat([]byte("abcdefghij"), copyChunkSize/10+100)
+	server.set("b/src", content)
+
+	// 复制期间其他客户端覆盖上传了源对象，配置了元数据缓存时也应检测到
+	cache, _ := InitMetadataCache(CacheOptions{})
+	client := server.client().WithCache(cache).WithMiddleware(beforeChunkGet(1, func() {
+		server.client().UploadOneChunk("b", "src", 0, bytes.ToUpper(content[:10]))
+	}))
+	if ret, err := client.CopyObject("b", "src", "b", "dst", 0); err == nil || ret.Ok {
+		t.Errorf("CopyObject(modified source) = %+v, %v", ret, err)
+	}
+}
@@ -0,0 +1,242 @@
+package goharbor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DedupStats 上传去重统计
+type DedupStats struct {
+	Checked    int   // 检查过的上传数
+	Skipped    int   // 跳过的上传数
+	BytesSaved int64 // 跳过上传的字节数
+}
+
+// dedupObject 一个已上传对象的记录
+type dedupObject struct {
+	Size           int64  `json:"size"`            // 本地文件大小
+	SHA256         string `json:"sha256"`          // 本地文件的sha256(hex)
+	RemoteSize     int64  `json:"remote_size"`     // 上传后服务器上的对象大小
+	RemoteModified string `json:"remote_modified"` // 上传后服务器上对象的最后修改时间
+}
+
+// fileDigest 本地文件内容的摘要，按文件大小和修改时间缓存
+type fileDigest struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256"`
+}
+
+type dedupIndexData struct {
+	Objects map[string]dedupObject `json:"objects"` // 桶和对象名称 -> 上传记录
+	Files   map[string]fileDigest  `json:"files"`   // 本地文件全路径 -> 摘要
+}
+
+// DedupIndex 上传去重的本地哈希索引，可被多个client共享
+// 上传前比较本地文件与服务器上的同名对象：对象自本客户端上传后未被修改、
+// 且本地文件的sha256与上传时相同时视为相同内容；元数据中没有内容摘要，
+// 只能由大小和最后修改时间判断对象是否被修改，修改时间精确到秒，
+// 其他客户端在同一秒内写入相同大小的不同内容时无法发现
+type DedupIndex struct {
+	mu    sync.Mutex
+	path  string
+	data  dedupIndexData
+	stats DedupStats
+}
+
+// InitDedupIndex 初始化去重索引
+// param path: 索引保存的文件路径，已存在时加载；""为只保存在内存中
+func InitDedupIndex(path string) (*DedupIndex, error) {
+	idx := &DedupIndex{path: path}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &idx.data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if idx.data.Objects == nil {
+		idx.data.Objects = make(map[string]dedupObject)
+	}
+	if idx.data.Files == nil {
+		idx.data.Files = make(map[string]fileDigest)
+	}
+	return idx, nil
+}
+
+// Stats 去重统计
+func (idx *DedupIndex) Stats() DedupStats {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.stats
+}
+
+// Save 保存索引，先写临时文件再重命名；上传成功后会自动保存
+func (idx *DedupIndex) Save() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.save()
+}
+
+// save 保存索引，调用者需持有锁
+func (idx *DedupIndex) save() error {
+	if idx.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(idx.data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0755); err != nil {
+		return err
+	}
+	tmp := idx.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.path)
+}
+
+// digest 计算文件的sha256，文件大小和修改时间未变时使用缓存
+func (idx *DedupIndex) digest(fileName string, fi os.FileInfo) (fileDigest, error) {
+	absName, err := filepath.Abs(fileName)
+	if err != nil {
+		return fileDigest{}, err
+	}
+	idx.mu.Lock()
+	d, ok := idx.data.Files[absName]
+	idx.mu.Unlock()
+	if ok && d.Size == fi.Size() && d.ModTime.Equal(fi.ModTime()) {
+		return d, nil
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return fileDigest{}, err
+	}
+	defer file.Close()
+	hs := sha256.New()
+	if _, err := io.Copy(hs, file); err != nil {
+		return fileDigest{}, err
+	}
+	d = fileDigest{
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+		SHA256:  hex.EncodeToString(hs.Sum(nil)),
+	}
+	idx.mu.Lock()
+	idx.data.Files[absName] = d
+	idx.mu.Unlock()
+	return d, nil
+}
+
+// identical 本地文件是否与服务器上的对象内容相同
+func (idx *DedupIndex) identical(key string, d fileDigest, obj MetadataStruct) bool {
+	idx.mu.Lock()
+	e, ok := idx.data.Objects[key]
+	idx.mu.Unlock()
+	if !ok || e.Size != d.Size || e.SHA256 != d.SHA256 || e.RemoteSize != int64(obj.Size) {
+		return false
+	}
+	return e.RemoteModified == remoteModified(obj)
+}
+
+// record 记录一个上传完成的对象并保存索引，保存失败时记录仍在内存中
+func (idx *DedupIndex) record(key string, o dedupObject) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.data.Objects[key] = o
+	idx.save()
+}
+
+// count 更新统计
+func (idx *DedupIndex) count(skipped bool, size int64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.stats.Checked++
+	if skipped {
+		idx.stats.Skipped++
+		idx.stats.BytesSaved += size
+	}
+}
+
+// remoteModified 对象的最后修改时间，未修改过时为上传时间
+func remoteModified(obj MetadataStruct) string {
+	if obj.UpdateTime != "" {
+		return obj.UpdateTime
+	}
+	return obj.UploadTime
+}
+
+// WithDedup 返回一个上传去重的client副本，UploadObject在服务器上已有相同内容的对象时跳过上传
+// 跳过时返回的ObjReturn.Skipped为true，节省的字节数见DedupIndex.Stats
+// param index: 去重索引，nil为不检查
+func (client ClientStruct) WithDedup(index *DedupIndex) ClientStruct {
+	client.API.configs.Dedup = index
+	return client
+}
+
+// dedupUploadObject 检查服务器上是否已有相同内容的对象，不同时上传并记录
+func (client ClientStruct) dedupUploadObject(bucketName, objPathName, fileName string, startOffset int64) (*ObjReturn, error) {
+	idx := client.API.configs.Dedup
+	client = client.WithDedup(nil)
+
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		return nil, err
+	}
+	d, err := idx.digest(fileName, fi)
+	if err != nil {
+		return nil, err
+	}
+	configs := client.API.configs
+	remoteName := objPathName
+	if configs.Compression != nil {
+		remoteName = compressedName(configs.Compression, objPathName)
+	}
+	key := objectCacheKey(cacheScope(&configs), bucketName, remoteName)
+
+	// 比较的是服务器上的当前状态，不使用元数据缓存
+	meta, err := client.WithCache(nil).GetMetadata(bucketName, remoteName)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Ok && meta.Obj.FileOrDir && idx.identical(key, d, meta.Obj) {
+		idx.count(true, fi.Size())
+		// 跳过的上传同样报告进度和传输指标，没有传输数据
+		pt := newProgressTracker(client.GetConfigs(), true, bucketName, objPathName, fi.Size(), fi.Size())
+		pt.start()
+		ret := &ObjReturn{Offset: fi.Size(), ObjSize: fi.Size(), Skipped: true}
+		ret.Ok = true
+		ret.CodeText = "identical object exists, upload skipped"
+		pt.finish(true, nil)
+		return ret, nil
+	}
+	idx.count(false, 0)
+
+	ret, err := client.uploadObject(bucketName, objPathName, fileName, startOffset)
+	if err != nil || !ret.Ok {
+		return ret, err
+	}
+	// 记录上传后服务器上对象的大小和修改时间，用于之后判断对象是否被其他客户端修改
+	if m, err := client.WithCache(nil).GetMetadata(bucketName, remoteName); err == nil && m.Ok {
+		idx.record(key, dedupObject{
+			Size:           fi.Size(),
+			SHA256:         d.SHA256,
+			RemoteSize:     int64(m.Obj.Size),
+			RemoteModified: remoteModified(m.Obj),
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,114 @@
+package goharbor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupUpload(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	dir := t.TempDir()
+	indexPath := filepath.Join(dir, "index", "dedup.json")
+	idx, err := InitDedupIndex(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := server.client().WithDedup(idx)
+
+	file := filepath.Join(dir, "out.csv")
+	content := bytes.Repeat([]byte("a,b,c\n"), 1000)
+	ioutil.WriteFile(file, content, 0644)
+
+	upload := func() *ObjReturn {
+		ret, err := client.UploadObject("b", "out/out.csv", file, 0)
+		if err != nil || !ret.IsDone() {
+			t.Fatalf("UploadObject() = %+v, %v", ret, err)
+		}
+		return ret
+	}
+
+	if ret := upload(); ret.Skipped || server.uploads != 1 {
+		t.Fatalf("first upload skipped = %v, uploads %d", ret.Skipped, server.uploads)
+	}
+	// 服务器未返回md5时使用本地索引
+	if ret := upload(); !ret.Skipped || server.uploads != 1 {
+		t.Fatalf("identical upload skipped = %v, uploads %d", ret.Skipped, server.uploads)
+	}
+
+	// 索引持久化，重新加载后仍可去重
+	idx2, err := InitDedupIndex(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = server.client().WithDedup(idx2)
+	if ret := upload(); !ret.Skipped {
+		t.Error("reloaded index should skip identical upload")
+	}
+
+	// 服务器上的对象被其他客户端修改
+	server.client().UploadReader("b", "out/out.csv", bytes.NewReader(bytes.ToUpper(content)))
+	uploads := server.uploads
+	if ret := upload(); ret.Skipped || server.uploads != uploads+1 {
+		t.Error("modified remote object should be uploaded again")
+	}
+
+	// 本地文件修改
+	ioutil.WriteFile(file, append(content, 'x'), 0644)
+	if ret := upload(); ret.Skipped {
+		t.Error("modified local file should be uploaded")
+	}
+	if s := idx2.Stats(); s.Checked != 3 || s.Skipped != 1 || s.BytesSaved != int64(len(content)) {
+		t.Errorf("Stats() = %+v", s)
+	}
+}
+
+func mustDedupIndex(t *testing.T) *DedupIndex {
+	idx, err := InitDedupIndex("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func TestDedupUploadRemoteState(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "out.csv")
+	content := bytes.Repeat([]byte("a,b,c\n"), 1000)
+	ioutil.WriteFile(file, content, 0644)
+
+	cache, err := InitMetadataCache(CacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []ProgressEvent
+	client := server.client().WithCache(cache).WithDedup(mustDedupIndex(t)).WithCompression(Gzip).
+		WithProgress(func(p Progress) { events = append(events, p.Event) })
+	upload := func() *ObjReturn {
+		ret, err := client.UploadObject("b", "out.csv", file, 0)
+		if err != nil || !ret.IsDone() {
+			t.Fatalf("UploadObject() = %+v, %v", ret, err)
+		}
+		return ret
+	}
+
+	upload()
+	events = nil
+	if ret := upload(); !ret.Skipped {
+		t.Fatal("identical upload should be skipped")
+	}
+	// 跳过的上传同样报告进度
+	if len(events) != 2 || events[0] != ProgressStarted || events[1] != ProgressCompleted {
+		t.Errorf("progress events = %v", events)
+	}
+
+	// 其他客户端修改对象，不能使用缓存的元数据
+	server.client().WithCompression(Gzip).UploadReader("b", "out.csv", bytes.NewReader(bytes.ToUpper(content)))
+	if ret := upload(); ret.Skipped {
+		t.Error("object modified by another client should be uploaded again")
+	}
+}
@@ -0,0 +1,268 @@
+package goharbor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MoveRenameDir 移动或重命名一个目录
+// 优先使用服务器端的目录移动，服务器不支持时在客户端逐个移动目录树下的对象：
+// 创建目标目录树，移动全部对象，再删除源目录树；中途失败时回滚已完成的操作，返回的Results为失败的那一步的结果
+// param bucketName: 桶名称
+// param dirPathName: 桶下全路径目录名称
+// param moveTo: 移动目录到此目录路径，""为不移动, "/"为根目录
+// param rename: 重命名目录，""为不重命名
+func (client ClientStruct) MoveRenameDir(bucketName, dirPathName, moveTo, rename string) (*MoveRenameReturn, error) {
+
+	srcPathName := buildPath([]string{dirPathName})
+	if srcPathName == "" {
+		return nil, errors.New("不能移动或重命名桶的根目录")
+	}
+	if strings.Contains(rename, "/") {
+		return nil, errors.New("rename can not contains '/'")
+	}
+
+	srcPath, srcName := CutPathAndName(srcPathName)
+	dstPath := srcPath
+	if moveTo != "" {
+		dstPath = buildPath([]string{moveTo})
+	}
+	dstName := srcName
+	if rename != "" {
+		dstName = rename
+	}
+	dstPathName := buildPath([]string{dstPath, dstName})
+	if dstPathName == srcPathName {
+		return nil, errors.New("目标目录与源目录相同")
+	}
+	if strings.HasPrefix(dstPathName+"/", srcPathName+"/") {
+		return nil, errors.New("不能将目录移动到其自身的子目录下")
+	}
+
+	// 源目录不存在时服务器端目录移动api也返回404，因此先确认源目录存在
+	src, err := client.WithCache(nil).GetMetadata(bucketName, srcPathName)
+	if err != nil {
+		return nil, err
+	}
+	if !src.Ok {
+		ret := MoveRenameReturn{Results: src.Results}
+		return &ret, nil
+	}
+	if src.Obj.FileOrDir {
+		return nil, errors.New(srcPathName + " 是一个对象，不是目录")
+	}
+
+	// 服务器端目录移动
+	resp, err := client.API.MoveRenameDir(bucketName, srcPath, srcName, moveTo, rename)
+	client.API.configs.Cache.invalidateTree(bucketName, srcPathName)
+	client.API.configs.Cache.invalidateTree(bucketName, dstPathName)
+	if err != nil {
+		return nil, err
+	}
+	ret := MoveRenameReturn{}
+	if resp.StatusCode == 201 {
+		ret.Ok = true
+		ret.Code = resp.StatusCode
+		ret.CodeText = "Successful to move directory"
+		decodeResponse(client.API.configs, resp.Bytes(), &ret)
+		return &ret, nil
+	}
+	if !isUnsupportedAPI(resp.StatusCode) {
+		ret.Results = *ResponseResult(resp)
+		if ret.CodeText == "" {
+			ret.CodeText = "Failed to move directory"
+		}
+		return &ret, nil
+	}
+
+	return client.moveDirTree(bucketName, srcPathName, dstPathName)
+}
+
+// MoveDir 移动一个目录
+// param bucketName: 桶名称
+// param dirPathName: 桶下全路径目录名称
+// param moveTo: 移动目录到此目录路径，"/"为根目录
+func (client ClientStruct) MoveDir(bucketName, dirPathName, moveTo string) (*MoveRenameReturn, error) {
+
+	return client.MoveRenameDir(bucketName, dirPathName, moveTo, "")
+}
+
+// RenameDir 重命名一个目录
+// param bucketName: 桶名称
+// param dirPathName: 桶下全路径目录名称
+// param rename: 目录新名称
+func (client ClientStruct) RenameDir(bucketName, dirPathName, rename string) (*MoveRenameReturn, error) {
+
+	return client.MoveRenameDir(bucketName, dirPathName, "", rename)
+}
+
+// isUnsupportedAPI 状态码是否表示服务器不支持此api，调用前应已确认请求的资源存在
+func isUnsupportedAPI(code int) bool {
+	return code == 404 || code == 405 || code == 501
+}
+
+// dirTreeMove 客户端目录树移动过程中已完成的操作，用于回滚
+type dirTreeMove struct {
+	client     ClientStruct
+	bucketName string
+	createdDir []string    // 已创建的目标目录，父目录在前
+	movedObj   [][2]string // 已移动的对象，[源全路径, 目标全路径]
+	deletedDir []string    // 已删除的源目录，子目录在前
+	srcDirs    []string    // 源目录树中的全部目录，父目录在前
+	objs       []MetadataStruct
+}
+
+// moveDirTree 客户端移动目录树
+func (client ClientStruct) moveDirTree(bucketName, srcPathName, dstPathName string) (*MoveRenameReturn, error) {
+
+	ret := MoveRenameReturn{}
+	dst, err := client.WithCache(nil).GetMetadata(bucketName, dstPathName)
+	if err != nil {
+		return nil, err
+	}
+	if dst.Ok {
+		ret.CodeText = "目标目录或对象已存在"
+		ret.Code = 400
+		return &ret, nil
+	}
+
+	m := &dirTreeMove{client: client, bucketName: bucketName}
+	if err := m.walk(srcPathName); err != nil {
+		return nil, err
+	}
+
+	if err := m.run(srcPathName, dstPathName); err != nil {
+		if rbErr := m.rollback(); rbErr != nil {
+			return nil, fmt.Errorf("%v; rollback failed: %v", err, rbErr)
+		}
+		if res, ok := err.(Results); ok {
+			ret.Results = res
+			ret.CodeText = "目录移动失败，已回滚: " + res.CodeText
+			return &ret, nil
+		}
+		return nil, err
+	}
+
+	meta, err := client.GetMetadata(bucketName, dstPathName)
+	if err != nil {
+		return nil, err
+	}
+	ret.Ok = true
+	ret.Code = 201
+	ret.CodeText = "Successful to move directory"
+	ret.BucketName = bucketName
+	ret.DirPath, _ = CutPathAndName(dstPathName)
+	ret.Obj = meta.Obj
+	return &ret, nil
+}
+
+// walk 遍历源目录树，收集全部目录和对象
+func (m *dirTreeMove) walk(dirPathName string) error {
+	m.srcDirs = append(m.srcDirs, dirPathName)
+	dir := m.client.Dir(m.bucketName, dirPathName)
+	files, err := dir.listAll()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		pathName := buildPath([]string{dirPathName, f.Name})
+		if f.FileOrDir {
+			f.PathName = pathName
+			m.objs = append(m.objs, f)
+			continue
+		}
+		if err := m.walk(pathName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run 创建目标目录树，移动全部对象，再删除源目录树
+func (m *dirTreeMove) run(srcPathName, dstPathName string) error {
+	for _, d := range m.srcDirs {
+		target := dstPathName + strings.TrimPrefix(d, srcPathName)
+		parent, name := CutPathAndName(target)
+		r, err := m.client.MakeDir(m.bucketName, parent, name)
+		if err != nil {
+			return err
+		}
+		if !r.Ok {
+			return *r
+		}
+		m.createdDir = append(m.createdDir, target)
+	}
+
+	for _, obj := range m.objs {
+		target := dstPathName + strings.TrimPrefix(obj.PathName, srcPathName)
+		targetDir, _ := CutPathAndName(target)
+		if targetDir == "" {
+			targetDir = "/"
+		}
+		r, err := m.client.MoveObject(m.bucketName, obj.PathName, targetDir)
+		if err != nil {
+			return err
+		}
+		if !r.Ok {
+			return r.Results
+		}
+		m.movedObj = append(m.movedObj, [2]string{obj.PathName, target})
+	}
+
+	// 删除源目录树，子目录在前
+	for i := len(m.srcDirs) - 1; i >= 0; i-- {
+		r, err := m.client.DeleteDir(m.bucketName, m.srcDirs[i])
+		if err != nil {
+			return err
+		}
+		if !r.Ok {
+			return *r
+		}
+		m.deletedDir = append(m.deletedDir, m.srcDirs[i])
+	}
+	return nil
+}
+
+// rollback 重新创建已删除的源目录，将已移动的对象移回原目录，并删除已创建的目标目录
+func (m *dirTreeMove) rollback() error {
+	var errs []string
+	for i := len(m.deletedDir) - 1; i >= 0; i-- {
+		parent, name := CutPathAndName(m.deletedDir[i])
+		r, err := m.client.MakeDir(m.bucketName, parent, name)
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else if !r.Ok {
+			errs = append(errs, r.CodeText)
+		}
+	}
+
+	for i := len(m.movedObj) - 1; i >= 0; i-- {
+		src, moved := m.movedObj[i][0], m.movedObj[i][1]
+		srcDir, _ := CutPathAndName(src)
+		if srcDir == "" {
+			srcDir = "/"
+		}
+		r, err := m.client.MoveObject(m.bucketName, moved, srcDir)
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else if !r.Ok {
+			errs = append(errs, r.CodeText)
+		}
+	}
+
+	for i := len(m.createdDir) - 1; i >= 0; i-- {
+		r, err := m.client.DeleteDir(m.bucketName, m.createdDir[i])
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else if !r.Ok {
+			errs = append(errs, r.CodeText)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
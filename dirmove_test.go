@@ -0,0 +1,240 @@
+package goharbor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memDirServer 保存显式目录树的测试服务，支持元数据、创建删除目录、列举目录和移动对象
+type memDirServer struct {
+	*httptest.Server
+	mu         sync.Mutex
+	nodes      map[string]bool // "bucket/path" -> 是否为对象
+	serverMove bool            // 是否支持服务器端目录移动
+	failMove   string          // 移动此对象时返回500
+	failDelete string          // 删除此目录时返回500
+	dirMoves   int             // 服务器端目录移动次数
+}
+
+func newMemDirServer(paths ...string) *memDirServer {
+	s := &memDirServer{nodes: make(map[string]bool)}
+	for _, p := range paths {
+		// 以"/"结尾的为目录
+		s.nodes[strings.TrimSuffix(p, "/")] = !strings.HasSuffix(p, "/")
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// tree 全部节点路径，目录以"/"结尾
+func (s *memDirServer) tree() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	for p, isObj := range s.nodes {
+		if !isObj {
+			p += "/"
+		}
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *memDirServer) children(key string) []string {
+	var names []string
+	for p := range s.nodes {
+		if strings.HasPrefix(p, key+"/") && !strings.Contains(strings.TrimPrefix(p, key+"/"), "/") {
+			names = append(names, strings.TrimPrefix(p, key+"/"))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *memDirServer) exists(key string) bool {
+	_, ok := s.nodes[key]
+	return ok || !strings.Contains(key, "/")
+}
+
+func (s *memDirServer) meta(key string) string {
+	pathName := key[strings.Index(key+"/", "/")+1:]
+	_, name := CutPathAndName(pathName)
+	return fmt.Sprintf(`{"na": %q, "name": %q, "fod": %v, "si": 0, "ult": "2020-10-18 08:00:00"}`, pathName, name, s.nodes[key])
+}
+
+func (s *memDirServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	parts := strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 4)
+	if len(parts) < 4 {
+		w.WriteHeader(404)
+		return
+	}
+	api, key := parts[2], parts[3]
+	reply := func(code int, body string) {
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}
+	switch {
+	case api == "metadata":
+		if _, ok := s.nodes[key]; !ok {
+			reply(404, `{"code_text": "not found"}`)
+			return
+		}
+		reply(200, `{"obj": `+s.meta(key)+`}`)
+	case api == "dir" && r.Method == http.MethodGet:
+		if !s.exists(key) {
+			reply(404, `{"code_text": "not found"}`)
+			return
+		}
+		var files []string
+		for _, name := range s.children(key) {
+			files = append(files, s.meta(key+"/"+name))
+		}
+		reply(200, fmt.Sprintf(`{"files": [%s], "count": %d}`, strings.Join(files, ","), len(files)))
+	case api == "dir" && r.Method == http.MethodPost:
+		if _, ok := s.nodes[key]; ok {
+			reply(400, `{"code_text": "exists", "existing": true}`)
+			return
+		}
+		if parent, _ := CutPathAndName(key); !s.exists(parent) {
+			reply(400, `{"code_text": "parent not found"}`)
+			return
+		}
+		s.nodes[key] = false
+		reply(201, `{"code_text": "created"}`)
+	case api == "dir" && r.Method == http.MethodDelete:
+		if key == s.failDelete {
+			reply(500, `{"code_text": "delete failed"}`)
+			return
+		}
+		if len(s.children(key)) > 0 {
+			reply(400, `{"code_text": "not empty"}`)
+			return
+		}
+		delete(s.nodes, key)
+		w.WriteHeader(204)
+	case api == "move":
+		if isObj, ok := s.nodes[key]; !ok || !isObj {
+			reply(404, `{"code_text": "not found"}`)
+			return
+		}
+		if key == s.failMove {
+			reply(500, `{"code_text": "move failed"}`)
+			return
+		}
+		bucket := strings.SplitN(key, "/", 2)[0]
+		_, name := CutPathAndName(key)
+		target := bucket + "/" + buildPath([]string{r.URL.Query().Get("move_to"), name})
+		if !s.exists(strings.TrimSuffix(target, "/"+name)) {
+			reply(400, `{"code_text": "target dir not found"}`)
+			return
+		}
+		delete(s.nodes, key)
+		s.nodes[target] = true
+		reply(201, `{"obj": `+s.meta(target)+`}`)
+	case api == "movedir" && s.serverMove:
+		bucket := strings.SplitN(key, "/", 2)[0]
+		_, name := CutPathAndName(key)
+		if rename := r.URL.Query().Get("rename"); rename != "" {
+			name = rename
+		}
+		parent, _ := CutPathAndName(key)
+		if moveTo := r.URL.Query().Get("move_to"); moveTo != "" {
+			parent = bucket + "/" + strings.Trim(moveTo, "/")
+		}
+		target := strings.TrimSuffix(parent, "/") + "/" + name
+		for p, isObj := range s.nodes {
+			if p == key || strings.HasPrefix(p, key+"/") {
+				delete(s.nodes, p)
+				s.nodes[target+strings.TrimPrefix(p, key)] = isObj
+			}
+		}
+		s.dirMoves++
+		reply(201, `{"obj": `+s.meta(target)+`}`)
+	default:
+		reply(404, `{"code_text": "no such api"}`)
+	}
+}
+
+var dirMoveTree = []string{
+	"b/src/", "b/src/a.txt", "b/src/sub/", "b/src/sub/b.txt", "b/src/sub/deep/", "b/src/sub/deep/c.txt", "b/other/",
+}
+
+func TestMoveDirServerSide(t *testing.T) {
+	server := newMemDirServer(dirMoveTree...)
+	defer server.Close()
+	server.serverMove = true
+	client := testClient(server.URL)
+
+	ret, err := client.MoveDir("b", "src", "other")
+	if err != nil || !ret.Ok || server.dirMoves != 1 {
+		t.Fatalf("MoveDir() = %+v, %v, server moves %d", ret, err, server.dirMoves)
+	}
+	want := []string{"b/other/", "b/other/src/", "b/other/src/a.txt", "b/other/src/sub/", "b/other/src/sub/b.txt",
+		"b/other/src/sub/deep/", "b/other/src/sub/deep/c.txt"}
+	if got := server.tree(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("tree = %v", got)
+	}
+
+	// 源目录不存在时不回退到客户端移动
+	ret, err = client.RenameDir("b", "missing", "x")
+	if err != nil || ret.Ok || ret.Code != 404 {
+		t.Errorf("RenameDir(missing) = %+v, %v", ret, err)
+	}
+	if _, err := client.RenameDir("b", "other/src/a.txt", "x"); err == nil {
+		t.Error("RenameDir() of an object should fail")
+	}
+}
+
+func TestMoveDirClientSide(t *testing.T) {
+	server := newMemDirServer(dirMoveTree...)
+	defer server.Close()
+	client := testClient(server.URL)
+
+	ret, err := client.RenameDir("b", "src", "dst")
+	if err != nil || !ret.Ok || ret.Obj.PathName != "dst" {
+		t.Fatalf("RenameDir() = %+v, %v", ret, err)
+	}
+	want := []string{"b/dst/", "b/dst/a.txt", "b/dst/sub/", "b/dst/sub/b.txt", "b/dst/sub/deep/", "b/dst/sub/deep/c.txt", "b/other/"}
+	if got := server.tree(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("tree = %v", got)
+	}
+
+	ret, err = client.RenameDir("b", "dst", "other")
+	if err != nil || ret.Ok {
+		t.Errorf("RenameDir(existing target) = %+v, %v", ret, err)
+	}
+}
+
+func TestMoveDirRollback(t *testing.T) {
+	for _, tc := range []struct {
+		name                 string
+		failMove, failDelete string
+	}{
+		{name: "move", failMove: "b/src/sub/deep/c.txt"},
+		{name: "delete source", failDelete: "b/src"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newMemDirServer(dirMoveTree...)
+			defer server.Close()
+			server.failMove, server.failDelete = tc.failMove, tc.failDelete
+			before := server.tree()
+
+			ret, err := testClient(server.URL).MoveRenameDir("b", "src", "other", "moved")
+			if err != nil || ret.Ok || ret.Code != 500 {
+				t.Fatalf("MoveRenameDir() = %+v, %v", ret, err)
+			}
+			if got := server.tree(); strings.Join(got, ",") != strings.Join(before, ",") {
+				t.Errorf("tree after rollback = %v, want %v", got, before)
+			}
+		})
+	}
+}
@@ -0,0 +1,479 @@
+package goharbor
+
+import (
+	"container/list"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// EncryptionSegmentSize 加密分段的明文大小，每段单独以AES-256-GCM加密和认证
+// 加密时UploadOneChunk的offset必须是此大小的整数倍；上传和下载对象使用的数据块大小都是它的整数倍
+const EncryptionSegmentSize = 64 * 1024
+
+const (
+	encHeaderSize   = 512 // 对象头大小，保存包装后的数据密钥
+	encTagSize      = 16  // GCM认证标签大小
+	encNonceSize    = 12
+	encSegOverhead  = encNonceSize + encTagSize // 每段密文比明文多出的随机nonce和认证标签
+	encRawSegSize   = EncryptionSegmentSize + encSegOverhead
+	encHeaderMagic  = "EVE2"
+	encDataKeySize  = 32
+	encMaxKeyFields = encHeaderSize - 4 - 4 - 2 - 2
+	encMaxKeys      = 1024 // 缓存的数据密钥数，超出时淘汰最久未使用的
+)
+
+// ErrObjectTampered 加密对象的数据被篡改、截断或损坏
+var ErrObjectTampered = errors.New("encrypted object is corrupted or has been tampered with")
+
+// KeyProvider 加密对象数据密钥的提供者（信封加密）
+// 每个对象使用随机生成的数据密钥加密，数据密钥由KeyProvider包装后保存在对象头中，
+// 可以实现此接口对接KMS等密钥管理服务
+type KeyProvider interface {
+	// WrapKey 包装一个数据密钥，返回包装所用的密钥ID和包装后的数据密钥
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey 按密钥ID解开包装后的数据密钥
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// StaticKeyProvider 使用本地主密钥以AES-256-GCM包装数据密钥的KeyProvider
+type StaticKeyProvider struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// InitStaticKeyProvider 初始化一个本地主密钥的KeyProvider
+// param keyID: 主密钥ID，保存在对象头中用于解密时选择主密钥
+// param masterKey: 32字节的主密钥
+func InitStaticKeyProvider(keyID string, masterKey []byte) (*StaticKeyProvider, error) {
+	p := &StaticKeyProvider{keys: make(map[string]cipher.AEAD)}
+	if err := p.AddKey(keyID, masterKey); err != nil {
+		return nil, err
+	}
+	p.current = keyID
+	return p, nil
+}
+
+// AddKey 添加一个只用于解密的主密钥，用于密钥轮换后读取旧对象
+func (p *StaticKeyProvider) AddKey(keyID string, masterKey []byte) error {
+	if keyID == "" {
+		return errors.New("keyID can not be empty")
+	}
+	aead, err := newAESGCM(masterKey)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys[keyID] = aead
+	return nil
+}
+
+// WrapKey 实现KeyProvider
+func (p *StaticKeyProvider) WrapKey(dataKey []byte) (string, []byte, error) {
+	p.mu.RLock()
+	keyID, aead := p.current, p.keys[p.current]
+	p.mu.RUnlock()
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return keyID, aead.Seal(nonce, nonce, dataKey, []byte(keyID)), nil
+}
+
+// UnwrapKey 实现KeyProvider
+func (p *StaticKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	p.mu.RLock()
+	aead, ok := p.keys[keyID]
+	p.mu.RUnlock()
+	if !ok {
+		return nil, errors.New("unknown master key id " + keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrObjectTampered
+	}
+	n := aead.NonceSize()
+	key, err := aead.Open(nil, wrapped[:n], wrapped[n:], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: can not unwrap data key", ErrObjectTampered)
+	}
+	return key, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("AES-256 key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// objectKey 一个加密对象的数据密钥
+type objectKey struct {
+	aead cipher.AEAD
+}
+
+// cachedKey 缓存的数据密钥
+type cachedKey struct {
+	name string
+	key  *objectKey
+}
+
+// Encryption 客户端加密，可被多个client共享
+// 对象布局为固定大小的对象头和依次排列的加密分段，每段以随机的nonce开始，密文比明文多16字节的认证标签；
+// 桶和对象路径、分段序号和是否为最后一段参与认证，因此分段被修改、重排、在对象之间交换或对象被截断时
+// 下载会返回ErrObjectTampered；续传重写分段时使用新的nonce，不会重复使用nonce
+type Encryption struct {
+	provider KeyProvider
+	mu       sync.Mutex
+	keys     map[string]*list.Element // 最近使用的对象的数据密钥，最多encMaxKeys个
+	lru      *list.List
+}
+
+// InitEncryption 初始化客户端加密
+// param provider: 数据密钥的提供者
+func InitEncryption(provider KeyProvider) *Encryption {
+	return &Encryption{provider: provider, keys: make(map[string]*list.Element), lru: list.New()}
+}
+
+// WithEncryption 返回一个上传时加密、下载时解密和校验的client副本
+// 加密对象在服务器上的大小（GetMetadata）为密文大小；密文与桶和对象路径绑定，
+// CopyObject解密后重新加密，在服务器端移动或重命名的加密对象无法解密
+// param enc: 客户端加密，nil为不加密
+func (client ClientStruct) WithEncryption(enc *Encryption) ClientStruct {
+	client.API.configs.Encryption = enc
+	return client
+}
+
+// newObjectKey 为对象生成新的数据密钥，返回数据密钥和对象头
+// param scope: 服务地址和访问密钥，见cacheScope
+func (enc *Encryption) newObjectKey(scope, bucketName, objPathName string) (*objectKey, []byte, error) {
+	dataKey := make([]byte, encDataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	keyID, wrapped, err := enc.provider.WrapKey(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(keyID)+len(wrapped) > encMaxKeyFields {
+		return nil, nil, errors.New("wrapped data key is too large for the object header")
+	}
+	aead, err := newAESGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := make([]byte, encHeaderSize)
+	copy(header, encHeaderMagic)
+	binary.BigEndian.PutUint32(header[4:], EncryptionSegmentSize)
+	i := 8
+	binary.BigEndian.PutUint16(header[i:], uint16(len(keyID)))
+	i += 2
+	i += copy(header[i:], keyID)
+	binary.BigEndian.PutUint16(header[i:], uint16(len(wrapped)))
+	i += 2
+	copy(header[i:], wrapped)
+
+	key := &objectKey{aead: aead}
+	enc.setKey(scope, bucketName, objPathName, key)
+	return key, header, nil
+}
+
+// parseHeader 解析对象头并解开数据密钥
+func (enc *Encryption) parseHeader(header []byte) (*objectKey, error) {
+	if len(header) != encHeaderSize || string(header[:4]) != encHeaderMagic {
+		return nil, fmt.Errorf("%w: invalid header", ErrObjectTampered)
+	}
+	if binary.BigEndian.Uint32(header[4:]) != EncryptionSegmentSize {
+		return nil, fmt.Errorf("%w: unsupported segment size", ErrObjectTampered)
+	}
+	i := 8
+	n := int(binary.BigEndian.Uint16(header[i:]))
+	i += 2
+	if n > encMaxKeyFields {
+		return nil, fmt.Errorf("%w: invalid header", ErrObjectTampered)
+	}
+	keyID := string(header[i : i+n])
+	i += n
+	m := int(binary.BigEndian.Uint16(header[i:]))
+	i += 2
+	if n+m > encMaxKeyFields {
+		return nil, fmt.Errorf("%w: invalid header", ErrObjectTampered)
+	}
+	dataKey, err := enc.provider.UnwrapKey(keyID, header[i:i+m])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAESGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &objectKey{aead: aead}, nil
+}
+
+func (enc *Encryption) getKey(scope, bucketName, objPathName string) *objectKey {
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+	elem, ok := enc.keys[objectCacheKey(scope, bucketName, objPathName)]
+	if !ok {
+		return nil
+	}
+	enc.lru.MoveToFront(elem)
+	return elem.Value.(*cachedKey).key
+}
+
+func (enc *Encryption) setKey(scope, bucketName, objPathName string, key *objectKey) {
+	name := objectCacheKey(scope, bucketName, objPathName)
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+	if elem, ok := enc.keys[name]; ok {
+		if key == nil {
+			enc.lru.Remove(elem)
+			delete(enc.keys, name)
+			return
+		}
+		elem.Value.(*cachedKey).key = key
+		enc.lru.MoveToFront(elem)
+		return
+	}
+	if key == nil {
+		return
+	}
+	enc.keys[name] = enc.lru.PushFront(&cachedKey{name: name, key: key})
+	for enc.lru.Len() > encMaxKeys {
+		elem := enc.lru.Back()
+		enc.lru.Remove(elem)
+		delete(enc.keys, elem.Value.(*cachedKey).name)
+	}
+}
+
+// encObjectName 参与分段认证的桶和对象路径
+func encObjectName(bucketName, objPathName string) string {
+	return bucketName + "/" + buildPath([]string{objPathName})
+}
+
+// segmentAD 分段的附加认证数据：桶和对象路径、分段序号和是否为最后一段
+func segmentAD(name string, index int64, final bool) []byte {
+	ad := make([]byte, len(name)+9)
+	n := copy(ad, name)
+	binary.BigEndian.PutUint64(ad[n:], uint64(index))
+	if final {
+		ad[n+8] = 1
+	}
+	return ad
+}
+
+// sealSegments 加密从第index段开始的明文，长度小于分段大小的段为最后一段
+// 每段使用新的随机nonce，同一分段被重写时不会重复使用nonce
+func (key *objectKey) sealSegments(name string, index int64, plain []byte) ([]byte, error) {
+	out := make([]byte, 0, len(plain)+(len(plain)/EncryptionSegmentSize+1)*encSegOverhead)
+	for {
+		n := len(plain)
+		if n > EncryptionSegmentSize {
+			n = EncryptionSegmentSize
+		}
+		final := n < EncryptionSegmentSize
+		nonce := make([]byte, encNonceSize)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		out = append(out, nonce...)
+		out = key.aead.Seal(out, nonce, plain[:n], segmentAD(name, index, final))
+		plain = plain[n:]
+		index++
+		if final || len(plain) == 0 {
+			return out, nil
+		}
+	}
+}
+
+// openSegments 解密并认证从第index段开始的密文
+func (key *objectKey) openSegments(name string, index int64, raw []byte) ([]byte, error) {
+	out := make([]byte, 0, len(raw))
+	for len(raw) > 0 {
+		n := len(raw)
+		if n > encRawSegSize {
+			n = encRawSegSize
+		}
+		if n < encSegOverhead {
+			return nil, fmt.Errorf("%w: segment %d is truncated", ErrObjectTampered, index)
+		}
+		final := n < encRawSegSize
+		if final && n < len(raw) {
+			return nil, fmt.Errorf("%w: data after the final segment", ErrObjectTampered)
+		}
+		var err error
+		out, err = key.aead.Open(out, raw[:encNonceSize], raw[encNonceSize:n], segmentAD(name, index, final))
+		if err != nil {
+			return nil, fmt.Errorf("%w: segment %d authentication failed", ErrObjectTampered, index)
+		}
+		raw = raw[n:]
+		index++
+	}
+	return out, nil
+}
+
+// plainObjectSize 由密文对象大小计算明文大小，complete为是否有最后一段
+func plainObjectSize(rawSize int64) (size int64, complete bool, err error) {
+	if rawSize < encHeaderSize {
+		return 0, false, fmt.Errorf("%w: object is too small", ErrObjectTampered)
+	}
+	body := rawSize - encHeaderSize
+	full, rem := body/encRawSegSize, body%encRawSegSize
+	if rem == 0 {
+		return full * EncryptionSegmentSize, false, nil
+	}
+	if rem < encSegOverhead {
+		return 0, false, fmt.Errorf("%w: object is truncated", ErrObjectTampered)
+	}
+	return full*EncryptionSegmentSize + rem - encSegOverhead, true, nil
+}
+
+// encryptedObjectKey 获取对象的数据密钥，未缓存或refresh时下载对象头
+// 服务器返回失败时error为Results
+func (client ClientStruct) encryptedObjectKey(bucketName, objPathName string, refresh bool) (*objectKey, error) {
+	enc := client.API.configs.Encryption
+	scope := cacheScope(&client.API.configs)
+	if !refresh {
+		if key := enc.getKey(scope, bucketName, objPathName); key != nil {
+			return key, nil
+		}
+	}
+	r, err := client.rawDownloadOneChunk(bucketName, objPathName, 0, encHeaderSize, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !r.Ok {
+		return nil, r.Results
+	}
+	key, err := enc.parseHeader(r.Chunk)
+	if err != nil {
+		return nil, err
+	}
+	enc.setKey(scope, bucketName, objPathName, key)
+	return key, nil
+}
+
+// encryptedUploadOneChunk 加密并上传一个数据块，offset为明文偏移量
+// offset为0时删除已有的对象并生成新的数据密钥，否则按对象头中的数据密钥续传；
+// 长度不是分段大小整数倍的数据块（包括空数据块）包含对象的最后一段，之后不能再上传数据
+// param encKey: 同一次上传共用的数据密钥，续传时只在其为nil时读取一次对象头；nil为每次都读取对象头
+func (client ClientStruct) encryptedUploadOneChunk(bucketName, objPathName string, offset int64, chunk []byte, encKey **objectKey) (*Results, error) {
+	if offset < 0 || offset%EncryptionSegmentSize != 0 {
+		return nil, errors.New("offset of an encrypted chunk must be a multiple of EncryptionSegmentSize")
+	}
+	enc := client.API.configs.Encryption
+	index := offset / EncryptionSegmentSize
+
+	var key *objectKey
+	if encKey != nil {
+		key = *encKey
+	}
+	var raw []byte
+	var err error
+	switch {
+	case offset == 0:
+		// 分片上传不会截断对象，比已有对象短时残留的旧分段会使下载校验失败
+		var r *Results
+		if r, err = client.resetObject(bucketName, objPathName); err != nil || !r.Ok {
+			return r, err
+		}
+		key, raw, err = enc.newObjectKey(cacheScope(&client.API.configs), bucketName, objPathName)
+	case key == nil:
+		// 对象可能已被其他client重新上传，缓存的数据密钥不能用于加密
+		key, err = client.encryptedObjectKey(bucketName, objPathName, true)
+	}
+	if err != nil {
+		if res, ok := err.(Results); ok {
+			return &res, nil
+		}
+		return nil, err
+	}
+	if encKey != nil {
+		*encKey = key
+	}
+	sealed, err := key.sealSegments(encObjectName(bucketName, objPathName), index, chunk)
+	if err != nil {
+		return nil, err
+	}
+	raw = append(raw, sealed...)
+
+	rawOffset := encHeaderSize + index*encRawSegSize
+	if offset == 0 {
+		rawOffset = 0
+	}
+	return client.uploadOneChunk(bucketName, objPathName, rawOffset, raw)
+}
+
+// finishEncryptedUpload 数据长度是分段大小的整数倍时，上传一个空的最后一段，使截断可被检测
+// param encKey: 同一次上传共用的数据密钥
+func (client ClientStruct) finishEncryptedUpload(bucketName, objPathName string, size int64, encKey **objectKey) (*Results, error) {
+	if client.API.configs.Encryption == nil || size == 0 || size%EncryptionSegmentSize != 0 {
+		return &Results{Ok: true}, nil
+	}
+	return client.uploadChunk(bucketName, objPathName, size, nil, encKey)
+}
+
+// encryptedDownloadOneChunk 下载并解密一个数据块，offset和size为明文的偏移量和大小
+func (client ClientStruct) encryptedDownloadOneChunk(bucketName, objPathName string, offset int64, size int, dv *downloadVersion) (*ChunkReturn, error) {
+	if offset < 0 || size <= 0 {
+		return nil, errors.New("offset must be non-negative and size must be positive")
+	}
+	first := offset / EncryptionSegmentSize
+	last := (offset + int64(size) - 1) / EncryptionSegmentSize
+	rawOffset := encHeaderSize + first*encRawSegSize
+	r, err := client.rawDownloadOneChunk(bucketName, objPathName, rawOffset, int((last-first+1)*encRawSegSize), dv)
+	if err != nil || !r.Ok {
+		return r, err
+	}
+	plainSize, complete, err := plainObjectSize(r.ObjSize)
+	if err != nil {
+		return nil, err
+	}
+
+	name := encObjectName(bucketName, objPathName)
+	key, err := client.encryptedObjectKey(bucketName, objPathName, false)
+	var plain []byte
+	if err == nil {
+		plain, err = key.openSegments(name, first, r.Chunk)
+		if errors.Is(err, ErrObjectTampered) {
+			// 缓存的数据密钥可能已过期（对象被重新上传）
+			if key, err = client.encryptedObjectKey(bucketName, objPathName, true); err == nil {
+				plain, err = key.openSegments(name, first, r.Chunk)
+			}
+		}
+	}
+	if err != nil {
+		if res, ok := err.(Results); ok {
+			return &ChunkReturn{Results: res}, nil
+		}
+		return nil, err
+	}
+	if !complete && rawOffset+int64(len(r.Chunk)) >= r.ObjSize {
+		return nil, fmt.Errorf("%w: object is truncated or its upload is incomplete", ErrObjectTampered)
+	}
+
+	lo := offset - first*EncryptionSegmentSize
+	if lo > int64(len(plain)) {
+		lo = int64(len(plain))
+	}
+	hi := lo + int64(size)
+	if hi > int64(len(plain)) {
+		hi = int64(len(plain))
+	}
+	cr := &ChunkReturn{Results: r.Results}
+	cr.ChunkOffset = offset
+	cr.ChunkSize = hi - lo
+	cr.ObjSize = plainSize
+	cr.Chunk = plain[lo:hi]
+	return cr, nil
+}
@@ -0,0 +1,237 @@
+package goharbor
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	provider, err := InitStaticKeyProvider("k1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := server.client().WithEncryption(InitEncryption(provider))
+
+	content := make([]byte, 2*EncryptionSegmentSize+100)
+	rand.New(rand.NewSource(1)).Read(content)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "data.bin")
+	ioutil.WriteFile(file, content, 0644)
+
+	ret, err := client.UploadObject("b", "data.bin", file, 0)
+	if err != nil || !ret.IsDone() {
+		t.Fatalf("UploadObject() = %+v, %v", ret, err)
+	}
+	raw, _ := server.get("b/data.bin")
+	if len(raw) != encHeaderSize+len(content)+3*encSegOverhead || bytes.Contains(raw, content[:64]) {
+		t.Fatalf("stored object is %d bytes", len(raw))
+	}
+
+	ret, err = client.DownLoadObject("b", "data.bin", filepath.Join(dir, "out"), "", 0)
+	if err != nil || !ret.IsDone() || ret.ObjSize != int64(len(content)) {
+		t.Fatalf("DownLoadObject() = %+v, %v", ret, err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "out", "data.bin")); !bytes.Equal(data, content) {
+		t.Error("downloaded file differs")
+	}
+
+	// 跨分段的随机读取
+	cr, err := client.DownloadOneChunk("b", "data.bin", EncryptionSegmentSize-10, 30)
+	if err != nil || !cr.Ok || !bytes.Equal(cr.Chunk, content[EncryptionSegmentSize-10:EncryptionSegmentSize+20]) {
+		t.Fatalf("DownloadOneChunk() = %+v, %v", cr.Results, err)
+	}
+
+	// 其他client凭对象头中的数据密钥续传
+	other := server.client().WithEncryption(InitEncryption(provider))
+	if r, err := client.UploadOneChunk("b", "resume.bin", 0, content[:EncryptionSegmentSize]); err != nil || !r.Ok {
+		t.Fatalf("UploadOneChunk() = %+v, %v", r, err)
+	}
+	if _, err := other.UploadOneChunk("b", "resume.bin", 10, content[10:]); err == nil {
+		t.Error("unaligned offset should fail")
+	}
+	if r, err := other.UploadOneChunk("b", "resume.bin", EncryptionSegmentSize, content[EncryptionSegmentSize:]); err != nil || !r.Ok {
+		t.Fatalf("UploadOneChunk() = %+v, %v", r, err)
+	}
+	rc, err := server.client().WithEncryption(InitEncryption(provider)).OpenObject("b", "resume.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(rc); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("resumed object read %d bytes, %v", len(data), err)
+	}
+
+	// 续传前重新读取对象头，其他client重新上传后缓存的数据密钥不再使用
+	content2 := append([]byte(nil), content...)
+	content2[0] ^= 1
+	if r, err := other.UploadOneChunk("b", "resume.bin", 0, content2[:EncryptionSegmentSize]); err != nil || !r.Ok {
+		t.Fatalf("UploadOneChunk() = %+v, %v", r, err)
+	}
+	if r, err := client.UploadOneChunk("b", "resume.bin", EncryptionSegmentSize, content2[EncryptionSegmentSize:]); err != nil || !r.Ok {
+		t.Fatalf("UploadOneChunk() = %+v, %v", r, err)
+	}
+	rc, _ = server.client().WithEncryption(InitEncryption(provider)).OpenObject("b", "resume.bin")
+	if data, err := ioutil.ReadAll(rc); err != nil || !bytes.Equal(data, content2) {
+		t.Errorf("re-uploaded object read %d bytes, %v", len(data), err)
+	}
+
+	// 覆盖上传更短的内容，不残留旧的分段
+	ioutil.WriteFile(file, content[:100], 0644)
+	if ret, err := client.UploadObject("b", "short.bin", filepath.Join(dir, "out", "data.bin"), 0); err != nil || !ret.IsDone() {
+		t.Fatalf("UploadObject() = %+v, %v", ret, err)
+	}
+	if ret, err := client.UploadObject("b", "short.bin", file, 0); err != nil || !ret.IsDone() {
+		t.Fatalf("UploadObject(short) = %+v, %v", ret, err)
+	}
+	rc, _ = client.OpenObject("b", "short.bin")
+	if data, err := ioutil.ReadAll(rc); err != nil || !bytes.Equal(data, content[:100]) {
+		t.Errorf("overwritten object read %d bytes, %v", len(data), err)
+	}
+
+	// 长度为分段大小整数倍的对象以空的最后一段结束
+	aligned := content[:2*EncryptionSegmentSize]
+	if ret, err := client.UploadReader("b", "aligned.bin", bytes.NewReader(aligned)); err != nil || !ret.IsDone() {
+		t.Fatalf("UploadReader() = %+v, %v", ret, err)
+	}
+	rc, _ = client.OpenObject("b", "aligned.bin")
+	if data, err := ioutil.ReadAll(rc); err != nil || !bytes.Equal(data, aligned) {
+		t.Errorf("aligned object read %d bytes, %v", len(data), err)
+	}
+
+	// 截断最后一段，未读到末尾的数据仍可读取
+	raw, _ = server.get("b/aligned.bin")
+	server.set("b/aligned.bin", raw[:len(raw)-encSegOverhead])
+	if cr, err := client.DownloadOneChunk("b", "aligned.bin", 0, 100); err != nil || !cr.Ok {
+		t.Errorf("DownloadOneChunk() of a truncated object = %v", err)
+	}
+	if _, err := client.DownloadOneChunk("b", "aligned.bin", EncryptionSegmentSize, EncryptionSegmentSize); !errors.Is(err, ErrObjectTampered) {
+		t.Errorf("truncated object error = %v", err)
+	}
+
+	// 密文与对象路径绑定，在服务器端移动的对象无法解密
+	raw, _ = server.get("b/data.bin")
+	server.set("b/moved.bin", raw)
+	if _, err := client.DownloadOneChunk("b", "moved.bin", 0, 10); !errors.Is(err, ErrObjectTampered) {
+		t.Errorf("moved object error = %v", err)
+	}
+
+	// 解密后重新加密复制，也可以复制为明文对象
+	if ret, err := client.CopyObject("b", "data.bin", "c", "copy.bin", 0); err != nil || !ret.IsDone() || ret.ObjSize != int64(len(content)) {
+		t.Fatalf("CopyObject() = %+v, %v", ret, err)
+	}
+	if cr, err := client.DownloadOneChunk("c", "copy.bin", 0, len(content)); err != nil || !bytes.Equal(cr.Chunk, content) {
+		t.Errorf("encrypted copy = %v", err)
+	}
+	if ret, err := CopyObjectBetween(client, server.client(), "b", "data.bin", "c", "plain.bin", 0); err != nil || !ret.IsDone() {
+		t.Fatalf("CopyObjectBetween() = %+v, %v", ret, err)
+	}
+	if data, _ := server.get("c/plain.bin"); !bytes.Equal(data, content) {
+		t.Error("decrypted copy differs")
+	}
+
+	// 修改密文
+	raw, _ = server.get("b/data.bin")
+	raw = append([]byte(nil), raw...)
+	raw[encHeaderSize+encRawSegSize+5] ^= 1
+	server.set("b/data.bin", raw)
+	if _, err := client.DownloadOneChunk("b", "data.bin", EncryptionSegmentSize, 10); !errors.Is(err, ErrObjectTampered) {
+		t.Errorf("tampered segment error = %v", err)
+	}
+	if cr, err := client.DownloadOneChunk("b", "data.bin", 0, 10); err != nil || !bytes.Equal(cr.Chunk, content[:10]) {
+		t.Errorf("untouched segment = %v", err)
+	}
+
+	// 错误的主密钥
+	wrong, _ := InitStaticKeyProvider("k1", bytes.Repeat([]byte{2}, 32))
+	if _, err := server.client().WithEncryption(InitEncryption(wrong)).DownloadOneChunk("b", "resume.bin", 0, 10); !errors.Is(err, ErrObjectTampered) {
+		t.Errorf("wrong master key error = %v", err)
+	}
+}
+
+func TestEncryptionNonceAndHeader(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	provider, _ := InitStaticKeyProvider("k1", bytes.Repeat([]byte{1}, 32))
+	client := server.client().WithEncryption(InitEncryption(provider))
+
+	// 续传重写同一分段时使用新的nonce
+	seg := bytes.Repeat([]byte{7}, EncryptionSegmentSize)
+	if r, err := client.UploadOneChunk("b", "n.bin", 0, seg); err != nil || !r.Ok {
+		t.Fatalf("UploadOneChunk() = %+v, %v", r, err)
+	}
+	var nonces [][]byte
+	for i := 0; i < 2; i++ {
+		if r, err := client.UploadOneChunk("b", "n.bin", EncryptionSegmentSize, seg[:100]); err != nil || !r.Ok {
+			t.Fatalf("UploadOneChunk() = %+v, %v", r, err)
+		}
+		raw, _ := server.get("b/n.bin")
+		nonces = append(nonces, append([]byte(nil), raw[encHeaderSize+encRawSegSize:][:encNonceSize]...))
+	}
+	if bytes.Equal(nonces[0], nonces[1]) {
+		t.Error("rewritten segment reused its nonce")
+	}
+	raw, _ := server.get("b/n.bin")
+	if bytes.Equal(raw[encHeaderSize:][:encNonceSize], raw[encHeaderSize+encRawSegSize:][:encNonceSize]) {
+		t.Error("segments share a nonce")
+	}
+
+	// 续传时每次上传只读取一次对象头
+	content := make([]byte, 2*copyChunkSize+100)
+	rand.New(rand.NewSource(2)).Read(content)
+	file := filepath.Join(t.TempDir(), "big.bin")
+	ioutil.WriteFile(file, content, 0644)
+	if r, err := client.UploadOneChunk("b", "big.bin", 0, content[:copyChunkSize]); err != nil || !r.Ok {
+		t.Fatalf("UploadOneChunk() = %+v, %v", r, err)
+	}
+	other := server.client().WithEncryption(InitEncryption(provider)).WithMiddleware(beforeChunkGet(2, func() {
+		t.Error("object header was read more than once")
+	}))
+	if ret, err := other.UploadObject("b", "big.bin", file, copyChunkSize); err != nil || !ret.IsDone() {
+		t.Fatalf("UploadObject() = %+v, %v", ret, err)
+	}
+	if cr, err := client.DownloadOneChunk("b", "big.bin", 0, len(content)); err != nil || !bytes.Equal(cr.Chunk, content) {
+		t.Errorf("resumed object = %v", err)
+	}
+}
+
+func TestEncryptionWithCompression(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	provider, _ := InitStaticKeyProvider("k1", bytes.Repeat([]byte{1}, 32))
+	client := server.client().WithEncryption(InitEncryption(provider)).WithCompression(Gzip)
+
+	content := bytes.Repeat([]byte("compressible "), 20000)
+	if ret, err := client.UploadReader("b", "x.txt", bytes.NewReader(content)); err != nil || !ret.Ok {
+		t.Fatalf("UploadReader() = %+v, %v", ret, err)
+	}
+	rc, err := client.OpenObject("b", "x.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(rc); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("OpenObject() read %d bytes, %v", len(data), err)
+	}
+}
+
+func TestEncryptionKeyCacheBound(t *testing.T) {
+	enc := InitEncryption(nil)
+	for i := 0; i <= encMaxKeys; i++ {
+		enc.setKey("", "b", strconv.Itoa(i), &objectKey{})
+	}
+	if enc.lru.Len() != encMaxKeys || len(enc.keys) != encMaxKeys {
+		t.Errorf("cached keys = %d, %d", enc.lru.Len(), len(enc.keys))
+	}
+	if enc.getKey("", "b", "0") != nil || enc.getKey("", "b", strconv.Itoa(encMaxKeys)) == nil {
+		t.Error("least recently used key should be evicted")
+	}
+	enc.setKey("", "b", "1", nil)
+	if enc.getKey("", "b", "1") != nil || len(enc.keys) != encMaxKeys-1 {
+		t.Error("setKey(nil) should remove the key")
+	}
+}
@@ -0,0 +1,320 @@
+package goharbor
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"goharbor/grequests"
+)
+
+// EndpointStrategy 端点选择策略
+type EndpointStrategy int
+
+const (
+	// RoundRobin 轮询健康的端点
+	RoundRobin EndpointStrategy = iota
+	// LeastLatency 选择平均请求耗时最短的健康端点
+	LeastLatency
+)
+
+// EndpointOptions 多端点选项
+type EndpointOptions struct {
+	Strategy EndpointStrategy // 端点选择策略
+	Cooldown time.Duration    // 失败的端点在此时间内不被优先选择，<=0时为30s
+}
+
+// endpoint 一个服务端点
+type endpoint struct {
+	host      string
+	downUntil time.Time     // 此时间之前视为不健康
+	latency   time.Duration // 请求耗时的指数移动平均，0为未测量
+	failures  int           // 连续失败次数
+}
+
+// EndpointStatus 端点状态
+type EndpointStatus struct {
+	Host     string
+	Healthy  bool
+	Latency  time.Duration // 平均请求耗时，0为未测量
+	Failures int           // 连续失败次数
+}
+
+// EndpointPool 同一EVHarbor服务的多个端点，可被多个client共享
+// 每次请求选择一个端点，网络错误或502/503/504时自动切换到其他端点重试；
+// 只有GET、HEAD和分片上传请求会切换端点重试，分片上传下载是按偏移量寻址的，因此传输中的对象可在其他端点上继续；
+// 创建目录、删除、移动、权限设置等请求可能已在失败的端点上执行，不会在其他端点上重放
+type EndpointPool struct {
+	mu   sync.Mutex
+	opts EndpointOptions
+	eps  []*endpoint
+	next int
+}
+
+// InitEndpointPool 初始化一个多端点池
+// param hosts: 端点地址，如 "obs1.example.com"、"10.0.0.2:8000"
+func InitEndpointPool(hosts []string, opts EndpointOptions) (*EndpointPool, error) {
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 30 * time.Second
+	}
+	p := &EndpointPool{opts: opts}
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		h = strings.TrimSpace(h)
+		if h == "" || seen[h] {
+			continue
+		}
+		seen[h] = true
+		p.eps = append(p.eps, &endpoint{host: h})
+	}
+	if len(p.eps) == 0 {
+		return nil, errors.New("at least one endpoint host is required")
+	}
+	return p, nil
+}
+
+// Hosts 全部端点地址
+func (p *EndpointPool) Hosts() []string {
+	hosts := make([]string, len(p.eps))
+	for i, ep := range p.eps {
+		hosts[i] = ep.host
+	}
+	return hosts
+}
+
+// Status 全部端点的状态
+func (p *EndpointPool) Status() []EndpointStatus {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ret := make([]EndpointStatus, len(p.eps))
+	for i, ep := range p.eps {
+		ret[i] = EndpointStatus{Host: ep.host, Healthy: !now.Before(ep.downUntil), Latency: ep.latency, Failures: ep.failures}
+	}
+	return ret
+}
+
+// pick 选择一个未尝试过的端点，优先选择健康的端点；全部尝试过时返回""
+func (p *EndpointPool) pick(tried map[string]bool, now time.Time) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(p.eps)
+	var best *endpoint
+	for i := 0; i < n; i++ {
+		ep := p.eps[(p.next+i)%n]
+		if tried[ep.host] || now.Before(ep.downUntil) {
+			continue
+		}
+		if p.opts.Strategy != LeastLatency {
+			p.next = (p.next + i + 1) % n
+			return ep.host
+		}
+		if best == nil || ep.latency < best.latency {
+			best = ep
+		}
+	}
+	if best != nil {
+		return best.host
+	}
+
+	// 没有健康的端点时，尝试最早恢复的端点
+	for _, ep := range p.eps {
+		if !tried[ep.host] && (best == nil || ep.downUntil.Before(best.downUntil)) {
+			best = ep
+		}
+	}
+	if best != nil {
+		return best.host
+	}
+	return ""
+}
+
+// get 获取端点，调用者需持有锁
+func (p *EndpointPool) get(host string) *endpoint {
+	for _, ep := range p.eps {
+		if ep.host == host {
+			return ep
+		}
+	}
+	return nil
+}
+
+// markOK 记录端点请求成功
+func (p *EndpointPool) markOK(host string, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ep := p.get(host)
+	if ep == nil {
+		return
+	}
+	ep.failures = 0
+	ep.downUntil = time.Time{}
+	if ep.latency == 0 {
+		ep.latency = latency
+	} else {
+		ep.latency = (ep.latency*7 + latency) / 8
+	}
+}
+
+// markFailed 记录端点请求失败，端点在冷却时间内不被优先选择
+func (p *EndpointPool) markFailed(host string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ep := p.get(host)
+	if ep == nil {
+		return
+	}
+	ep.failures++
+	ep.downUntil = now.Add(p.opts.Cooldown)
+}
+
+// isEndpointFailure 状态码是否表示端点不可用，可换其他端点重试
+func isEndpointFailure(code int) bool {
+	return code == 502 || code == 503 || code == 504
+}
+
+// isFailoverSafe 请求是否可以在其他端点上重放
+// 分片上传按chunk_offset写入，重复写入同一数据块的结果相同
+func isFailoverSafe(method string, ro *grequests.RequestOptions) bool {
+	switch method {
+	case "GET", "HEAD":
+		return true
+	case "POST":
+		if ro == nil {
+			return false
+		}
+		_, ok := ro.Data["chunk_offset"]
+		return ok && len(ro.Files) > 0
+	}
+	return false
+}
+
+// replaceHost 替换url的host
+func replaceHost(rawURL, host string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Host = host
+	return u.String()
+}
+
+// signAndDoFailover 签名并发送请求，配置了多端点时失败后切换端点重试
+// 不可重放的请求只发送到一个端点
+// 返回发送请求的次数
+func (r RequestStruct) signAndDoFailover(method, url, fullPath string, ro *grequests.RequestOptions) (*grequests.Response, int, error) {
+	pool := r.configs.Endpoints
+	if pool == nil {
+		resp, err := r.signAndDo(method, url, fullPath, ro)
+		return resp, 1, err
+	}
+
+	tried := make(map[string]bool)
+	failover := isFailoverSafe(method, ro)
+	var resp *grequests.Response
+	var err error
+	n := 0
+	for {
+		host := pool.pick(tried, time.Now())
+		if host == "" || (n > 0 && !failover) {
+			return resp, n, err
+		}
+		if n > 0 && !rewindRequestOptions(ro) {
+			return resp, n, err
+		}
+		if resp != nil {
+			resp.Close()
+		}
+		tried[host] = true
+		n++
+
+		start := time.Now()
+		resp, err = r.signAndDo(method, replaceHost(url, host), fullPath, ro)
+		if err == nil && !isEndpointFailure(resp.StatusCode) {
+			pool.markOK(host, time.Since(start))
+			return resp, n, nil
+		}
+		pool.markFailed(host, time.Now())
+	}
+}
+
+// WithEndpoints 返回一个使用多端点池的client副本
+// param pool: 多端点池，nil为只使用HOST
+func (client ClientStruct) WithEndpoints(pool *EndpointPool) ClientStruct {
+	client.API.configs.Endpoints = pool
+	if pool != nil {
+		client.API.configs.Host = pool.eps[0].host
+	}
+	return client
+}
+
+// CheckEndpoints 检查全部端点的健康状态，能返回任意http响应的端点视为健康
+// 返回不健康端点的错误
+func (client ClientStruct) CheckEndpoints() map[string]error {
+	configs := client.API.configs
+	pool := configs.Endpoints
+	if pool == nil {
+		return nil
+	}
+	hc := configs.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, host := range pool.Hosts() {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			start := time.Now()
+			u := url.URL{Scheme: configs.Scheme, Host: host, Path: "/"}
+			resp, err := hc.Head(u.String())
+			if err == nil {
+				resp.Body.Close()
+				if isEndpointFailure(resp.StatusCode) {
+					err = errors.New(resp.Status)
+				}
+			}
+			if err != nil {
+				pool.markFailed(host, time.Now())
+				mu.Lock()
+				errs[host] = err
+				mu.Unlock()
+				return
+			}
+			pool.markOK(host, time.Since(start))
+		}(host)
+	}
+	wg.Wait()
+	return errs
+}
+
+// StartHealthCheck 启动后台定期健康检查，返回停止函数
+// param interval: 检查间隔，<=0时为30s
+func (client ClientStruct) StartHealthCheck(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		client.CheckEndpoints()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				client.CheckEndpoints()
+			}
+		}
+	}()
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,148 @@
+package goharbor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_EndpointFailover(t *testing.T) {
+	var down, upHits int
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		down++
+		w.WriteHeader(503)
+	}))
+	defer bad.Close()
+	var gotChunk string
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upHits++
+		if f, _, err := r.FormFile("chunk"); err == nil {
+			data, _ := ioutil.ReadAll(f)
+			gotChunk = string(data)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code_text": "ok"}`))
+	}))
+	defer good.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadHost := strings.TrimPrefix(dead.URL, "http://")
+	dead.Close()
+
+	badHost := strings.TrimPrefix(bad.URL, "http://")
+	goodHost := strings.TrimPrefix(good.URL, "http://")
+	configs, err := InitConfig(map[ConfigKeyType]string{
+		SCHEME:    HTTP,
+		HOSTS:     deadHost + "," + badHost + "," + goodHost,
+		ACCESSKEY: "666666",
+		SECRETKEY: "888888",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configs.Host != deadHost {
+		t.Errorf("Host = %s", configs.Host)
+	}
+	client := InitClient(configs)
+
+	// 上传数据块在失败的端点之后由其他端点完成，请求体被重新读取
+	r, err := client.UploadOneChunk("b", "a/x.txt", 0, []byte("hello"))
+	if err != nil || !r.Ok || gotChunk != "hello" || down != 1 || upHits != 1 {
+		t.Fatalf("UploadOneChunk() = %+v, %v, chunk %q, down %d, up %d", r, err, gotChunk, down, upHits)
+	}
+
+	// 失败的端点在冷却时间内不被选择
+	client.UploadOneChunk("b", "a/x.txt", 5, []byte("world"))
+	if down != 1 || upHits != 2 {
+		t.Errorf("down %d, up %d", down, upHits)
+	}
+	for _, s := range configs.Endpoints.Status() {
+		if s.Healthy != (s.Host == goodHost) {
+			t.Errorf("status %+v", s)
+		}
+	}
+
+	errs := client.CheckEndpoints()
+	if len(errs) != 2 || errs[goodHost] != nil {
+		t.Errorf("CheckEndpoints() = %v", errs)
+	}
+
+	// 不可重放的请求不切换端点
+	pool, _ := InitEndpointPool([]string{badHost, goodHost}, EndpointOptions{})
+	down, upHits = 0, 0
+	r2, err := client.WithEndpoints(pool).DeleteObject("b", "a/x.txt")
+	if err != nil || r2.Ok || r2.Code != 503 || down != 1 || upHits != 0 {
+		t.Errorf("DeleteObject() = %+v, %v, down %d, up %d", r2, err, down, upHits)
+	}
+	if !isFailoverSafe("GET", nil) || isFailoverSafe("PATCH", nil) || isFailoverSafe("POST", nil) {
+		t.Error("isFailoverSafe() mismatch")
+	}
+}
+
+func Test_EndpointPoolPick(t *testing.T) {
+	p, _ := InitEndpointPool([]string{"a", "b", "c", "a"}, EndpointOptions{})
+	if len(p.Hosts()) != 3 {
+		t.Fatalf("Hosts() = %v", p.Hosts())
+	}
+	now := time.Now()
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, p.pick(nil, now))
+	}
+	if strings.Join(got, "") != "abca" {
+		t.Errorf("round robin = %v", got)
+	}
+
+	p, _ = InitEndpointPool([]string{"a", "b", "c"}, EndpointOptions{Strategy: LeastLatency})
+	p.markOK("a", 30*time.Millisecond)
+	p.markOK("b", 10*time.Millisecond)
+	p.markOK("c", 20*time.Millisecond)
+	if h := p.pick(nil, now); h != "b" {
+		t.Errorf("least latency = %s", h)
+	}
+	if h := p.pick(map[string]bool{"b": true}, now); h != "c" {
+		t.Errorf("least latency excluding b = %s", h)
+	}
+
+	// 全部不健康时选择最早恢复的端点
+	p.markFailed("a", now)
+	p.markFailed("b", now.Add(time.Second))
+	p.markFailed("c", now.Add(2*time.Second))
+	if h := p.pick(nil, now); h != "a" {
+		t.Errorf("all down = %s", h)
+	}
+	if h := p.pick(map[string]bool{"a": true, "b": true, "c": true}, now); h != "" {
+		t.Errorf("all tried = %s", h)
+	}
+}
+
+func Test_StartHealthCheck(t *testing.T) {
+	checked := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case checked <- struct{}{}:
+		default:
+		}
+	}))
+	defer server.Close()
+	configs, err := InitConfig(map[ConfigKeyType]string{
+		SCHEME:    HTTP,
+		HOSTS:     strings.TrimPrefix(server.URL, "http://"),
+		ACCESSKEY: "666666",
+		SECRETKEY: "888888",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// interval<=0时使用默认间隔，启动时立即检查一次
+	stop := InitClient(configs).StartHealthCheck(0)
+	defer stop()
+	select {
+	case <-checked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the first health check")
+	}
+}
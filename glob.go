@@ -0,0 +1,168 @@
+package goharbor
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Glob 获取桶下与模式匹配的全部对象和目录
+// 模式以"/"分隔，每一段支持 * ? [...] 通配符（同path.Match），"**"匹配零个或多个目录；
+// 遍历时只列举可能匹配的目录，不含通配符的段直接定位，不列举其父目录
+// param bucketName: 桶名称
+// param pattern: 匹配模式，如 "runs/2026-*/**/*.fastq.gz"
+func (client ClientStruct) Glob(bucketName, pattern string) ([]MetadataStruct, error) {
+	g := &globber{
+		list: func(dirPathName string) ([]MetadataStruct, error) {
+			return client.Dir(bucketName, dirPathName).listAll()
+		},
+		stat: func(pathName string) (*MetadataStruct, error) {
+			r, err := client.GetMetadata(bucketName, pathName)
+			if err != nil {
+				return nil, err
+			}
+			if !r.Ok {
+				return nil, nil
+			}
+			return &r.Obj, nil
+		},
+	}
+	return g.glob(pattern)
+}
+
+// globber 远程路径模式匹配
+type globber struct {
+	list    func(dirPathName string) ([]MetadataStruct, error) // 列举目录，目录不存在时返回error
+	stat    func(pathName string) (*MetadataStruct, error)     // 获取元数据，不存在时返回nil
+	listed  map[string][]MetadataStruct
+	matched map[string]MetadataStruct
+}
+
+// hasMeta 模式段是否包含通配符
+func hasMeta(seg string) bool {
+	return strings.ContainsAny(seg, `*?[\`)
+}
+
+// splitPattern 切分并校验模式
+func splitPattern(pattern string) ([]string, error) {
+	var segs []string
+	for _, seg := range strings.Split(pattern, "/") {
+		if seg == "" {
+			continue
+		}
+		if seg == "**" && len(segs) > 0 && segs[len(segs)-1] == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+		segs = append(segs, seg)
+	}
+	return segs, nil
+}
+
+func (g *globber) glob(pattern string) ([]MetadataStruct, error) {
+	segs, err := splitPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	g.listed = make(map[string][]MetadataStruct)
+	g.matched = make(map[string]MetadataStruct)
+	if err := g.match("", segs); err != nil {
+		return nil, err
+	}
+
+	ret := make([]MetadataStruct, 0, len(g.matched))
+	for _, m := range g.matched {
+		ret = append(ret, m)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].PathName < ret[j].PathName
+	})
+	return ret, nil
+}
+
+// listDir 列举目录（每个目录只列举一次），目录不存在时返回空
+func (g *globber) listDir(dirPathName string) ([]MetadataStruct, error) {
+	if files, ok := g.listed[dirPathName]; ok {
+		return files, nil
+	}
+	files, err := g.list(dirPathName)
+	if err != nil {
+		if r, ok := err.(Results); ok && r.Code == 404 {
+			files, err = nil, nil
+		} else {
+			return nil, err
+		}
+	}
+	for i := range files {
+		files[i].PathName = buildPath([]string{dirPathName, files[i].Name})
+	}
+	g.listed[dirPathName] = files
+	return files, nil
+}
+
+func (g *globber) add(m MetadataStruct) {
+	g.matched[m.PathName] = m
+}
+
+// match 在目录dirPathName下匹配剩余的模式段
+func (g *globber) match(dirPathName string, segs []string) error {
+	if len(segs) == 0 {
+		return nil
+	}
+	seg, rest := segs[0], segs[1:]
+
+	// 不含通配符的段直接定位
+	if !hasMeta(seg) {
+		pathName := buildPath([]string{dirPathName, seg})
+		if len(rest) > 0 {
+			return g.match(pathName, rest)
+		}
+		m, err := g.stat(pathName)
+		if err != nil || m == nil {
+			return err
+		}
+		m.PathName = pathName
+		g.add(*m)
+		return nil
+	}
+
+	files, err := g.listDir(dirPathName)
+	if err != nil {
+		return err
+	}
+
+	if seg == "**" {
+		// 匹配零个目录
+		if err := g.match(dirPathName, rest); err != nil {
+			return err
+		}
+		for _, f := range files {
+			if len(rest) == 0 {
+				g.add(f)
+			}
+			if !f.FileOrDir {
+				if err := g.match(f.PathName, segs); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, f := range files {
+		if ok, _ := path.Match(seg, f.Name); !ok {
+			continue
+		}
+		if len(rest) == 0 {
+			g.add(f)
+		} else if !f.FileOrDir {
+			if err := g.match(f.PathName, rest); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package goharbor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_globber_glob(t *testing.T) {
+	tree := map[string][]MetadataStruct{
+		"": {{Name: "runs"}, {Name: "readme.md", FileOrDir: true}},
+		"runs": {
+			{Name: "2026-01"}, {Name: "2025-12"}, {Name: "x.fastq.gz", FileOrDir: true},
+		},
+		"runs/2026-01":       {{Name: "a.fastq.gz", FileOrDir: true}, {Name: "lane1"}},
+		"runs/2026-01/lane1": {{Name: "b.fastq.gz", FileOrDir: true}, {Name: "b.txt", FileOrDir: true}},
+		"runs/2025-12":       {{Name: "c.fastq.gz", FileOrDir: true}},
+	}
+	var listed []string
+	g := &globber{
+		list: func(dirPathName string) ([]MetadataStruct, error) {
+			listed = append(listed, dirPathName)
+			files, ok := tree[dirPathName]
+			if !ok {
+				return nil, Results{Code: 404}
+			}
+			return append([]MetadataStruct(nil), files...), nil
+		},
+		stat: func(pathName string) (*MetadataStruct, error) {
+			dir, name := CutPathAndName(pathName)
+			for _, f := range tree[dir] {
+				if f.Name == name {
+					return &f, nil
+				}
+			}
+			return nil, nil
+		},
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+		listed  []string
+	}{
+		{
+			pattern: "runs/2026-*/**/*.fastq.gz",
+			want:    []string{"runs/2026-01/a.fastq.gz", "runs/2026-01/lane1/b.fastq.gz"},
+			listed:  []string{"runs", "runs/2026-01", "runs/2026-01/lane1"},
+		},
+		{
+			pattern: "runs/20??-1[0-2]/*",
+			want:    []string{"runs/2025-12/c.fastq.gz"},
+			listed:  []string{"runs", "runs/2025-12"},
+		},
+		{
+			pattern: "readme.md",
+			want:    []string{"readme.md"},
+		},
+		{
+			pattern: "nothing/*",
+			want:    []string{},
+			listed:  []string{"nothing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			listed = nil
+			got, err := g.glob(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, m := range got {
+				names = append(names, m.PathName)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("glob() = %v, want %v", names, tt.want)
+			}
+			if strings.Join(listed, ",") != strings.Join(tt.listed, ",") {
+				t.Errorf("listed dirs = %v, want %v", listed, tt.listed)
+			}
+		})
+	}
+
+	if _, err := g.glob("runs/[a"); err == nil {
+		t.Error("bad pattern should return error")
+	}
+}
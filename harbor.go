@@ -7,10 +7,13 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"goharbor/grequests"
 )
@@ -33,8 +36,39 @@ const (
 	ACCESSKEY ConfigKeyType = iota
 	// SECRETKEY 配置选项key
 	SECRETKEY ConfigKeyType = iota
+	// SIGNATURETTL 配置选项key，访问密钥签名有效期，单位为秒s
+	SIGNATURETTL ConfigKeyType = iota
+	// CLOCKSKEW 配置选项key，"true"时根据服务器时间检测并补偿本地时钟偏差
+	CLOCKSKEW ConfigKeyType = iota
+	// RATELIMIT 配置选项key，上传下载的带宽限制，单位为byte/s
+	RATELIMIT ConfigKeyType = iota
+	// CAFILE 配置选项key，信任的CA证书文件(PEM)
+	CAFILE ConfigKeyType = iota
+	// CERTFILE 配置选项key，客户端证书文件(PEM)
+	CERTFILE ConfigKeyType = iota
+	// KEYFILE 配置选项key，客户端证书私钥文件(PEM)
+	KEYFILE ConfigKeyType = iota
+	// INSECURESKIPVERIFY 配置选项key，"true"时跳过服务器证书校验
+	INSECURESKIPVERIFY ConfigKeyType = iota
+	// PROXY 配置选项key，代理url
+	PROXY ConfigKeyType = iota
+	// UNIXSOCKET 配置选项key，通过Unix socket连接服务
+	UNIXSOCKET ConfigKeyType = iota
+	// DIALTIMEOUT 配置选项key，建立连接的超时时间，如 "10s"
+	DIALTIMEOUT ConfigKeyType = iota
+	// TLSTIMEOUT 配置选项key，TLS握手的超时时间，如 "10s"
+	TLSTIMEOUT ConfigKeyType = iota
+	// REQUESTTIMEOUT 配置选项key，单个请求的超时时间，如 "5m"
+	REQUESTTIMEOUT ConfigKeyType = iota
+	// HOSTS 配置选项key，逗号分隔的多个端点地址，失败时自动切换，第一个端点同时作为HOST
+	HOSTS ConfigKeyType = iota
+	// COMPRESSION 配置选项key，客户端压缩编码名称，如 "gzip"
+	COMPRESSION ConfigKeyType = iota
 )
 
+// DefaultSignatureTTL 默认的访问密钥签名有效期，单位为秒s
+const DefaultSignatureTTL int64 = 3600
+
 //ConfigStruct 是一个配置相关结构体
 type ConfigStruct struct {
 	Version           string
@@ -46,8 +80,28 @@ type ConfigStruct struct {
 	APIDirPrefix      string
 	APIBucketPrefix   string
 	APIMovePrefix     string
+	APIMoveDirPrefix  string
 	APIMetadataPrefix string
 	APIStatsPrefix    string
+	SignatureTTL      int64            // 访问密钥签名有效期，单位为秒s，<=0时使用DefaultSignatureTTL
+	DetectClockSkew   bool             // 是否根据服务器响应的Date头检测本地时钟偏差，并在签名过期时重试一次
+	Progress          ProgressFunc     // 对象上传下载的进度回调，可以为nil
+	RateLimiter       *RateLimiter     // 上传下载数据块的带宽限制，nil为不限制
+	Cache             *MetadataCache   // 元数据和目录列表缓存，nil为不缓存
+	BlockCache        *BlockCache      // 对象数据块的本地磁盘缓存，nil为不缓存
+	Logger            *slog.Logger     // 记录每个api请求的日志，nil为不记录
+	Metrics           Metrics          // 请求和传输指标收集，nil为不收集
+	Tracer            Tracer           // 请求和传输的追踪，nil为不追踪
+	Middlewares       []Middleware     // 请求中间件，按顺序由外到内，在签名之后、发送之前调用
+	Transport         TransportOptions // TLS、代理、超时等传输配置
+	HTTPClient        *http.Client     // 发送请求的http client，由Transport创建，nil使用默认client
+	Endpoints         *EndpointPool    // 多端点池，nil为只使用Host
+	Compression       Codec            // 上传时客户端压缩、下载时解压的编码，nil为不压缩
+	Encryption        *Encryption      // 客户端加密，nil为不加密
+	Dedup             *DedupIndex      // 上传前跳过远端已有的相同内容，nil为不检查
+	span              Span             // 当前调用所属的追踪片段
+	clockSkew         *clockSkew
+	transportErr      error // InitClient由Transport创建HTTPClient失败的错误，发送请求时返回
 }
 
 //DefaultConfigs is default config
@@ -59,8 +113,10 @@ var defaultConfigs = ConfigStruct{
 	APIDirPrefix:      "dir",
 	APIBucketPrefix:   "buckets",
 	APIMovePrefix:     "move",
+	APIMoveDirPrefix:  "movedir",
 	APIMetadataPrefix: "metadata",
 	APIStatsPrefix:    "stats",
+	SignatureTTL:      DefaultSignatureTTL,
 }
 
 //GetDefaultConfig return default configs
@@ -70,6 +126,20 @@ func GetDefaultConfig() ConfigStruct {
 
 // InitConfig 初始化并返回一个ConfigStruct对象
 func InitConfig(c map[ConfigKeyType]string) (config ConfigStruct, err error) {
+	config, err = parseConfig(c)
+	if err != nil {
+		return
+	}
+
+	if config.Accesskey == "" || config.Secretkey == "" {
+		err = errors.New("Valid values must be configured for both ACCESSKEY and SECRETKEY")
+		return
+	}
+	return
+}
+
+// parseConfig 解析配置map，不检查访问密钥
+func parseConfig(c map[ConfigKeyType]string) (config ConfigStruct, err error) {
 	config = GetDefaultConfig()
 
 	for key, value := range c {
@@ -84,13 +154,89 @@ func InitConfig(c map[ConfigKeyType]string) (config ConfigStruct, err error) {
 			config.Accesskey = value
 		case SECRETKEY:
 			config.Secretkey = value
+		case SIGNATURETTL:
+			ttl, e := strconv.ParseInt(value, 10, 64)
+			if e != nil || ttl <= 0 {
+				err = errors.New("SIGNATURETTL must be a positive integer of seconds")
+				return
+			}
+			config.SignatureTTL = ttl
+		case CLOCKSKEW:
+			detect, e := strconv.ParseBool(value)
+			if e != nil {
+				err = errors.New("CLOCKSKEW must be a boolean value")
+				return
+			}
+			config.DetectClockSkew = detect
+		case RATELIMIT:
+			limit, e := strconv.ParseInt(value, 10, 64)
+			if e != nil || limit < 0 {
+				err = errors.New("RATELIMIT must be a non-negative integer of bytes per second")
+				return
+			}
+			if limit > 0 {
+				config.RateLimiter = InitRateLimiter(limit, 0)
+			}
+		case CAFILE:
+			config.Transport.CAFile = value
+		case CERTFILE:
+			config.Transport.CertFile = value
+		case KEYFILE:
+			config.Transport.KeyFile = value
+		case INSECURESKIPVERIFY:
+			insecure, e := strconv.ParseBool(value)
+			if e != nil {
+				err = errors.New("INSECURESKIPVERIFY must be a boolean value")
+				return
+			}
+			config.Transport.InsecureSkipVerify = insecure
+		case PROXY:
+			config.Transport.ProxyURL = value
+		case UNIXSOCKET:
+			config.Transport.UnixSocket = value
+		case DIALTIMEOUT, TLSTIMEOUT, REQUESTTIMEOUT:
+			d, e := time.ParseDuration(value)
+			if e != nil || d < 0 {
+				err = errors.New("DIALTIMEOUT, TLSTIMEOUT and REQUESTTIMEOUT must be non-negative durations, such as \"30s\"")
+				return
+			}
+			switch key {
+			case DIALTIMEOUT:
+				config.Transport.DialTimeout = d
+			case TLSTIMEOUT:
+				config.Transport.TLSHandshakeTimeout = d
+			default:
+				config.Transport.RequestTimeout = d
+			}
+		case COMPRESSION:
+			if value == "" {
+				break
+			}
+			codec, ok := GetCodec(value)
+			if !ok {
+				err = errors.New("COMPRESSION codec " + value + " is not registered")
+				return
+			}
+			config.Compression = codec
 		}
 	}
 
-	if config.Accesskey == "" || config.Secretkey == "" {
-		err = errors.New("Valid values must be configured for both ACCESSKEY and SECRETKEY")
-		return
+	if hosts, ok := c[HOSTS]; ok {
+		config.Endpoints, err = InitEndpointPool(strings.Split(hosts, ","), EndpointOptions{})
+		if err != nil {
+			return
+		}
+		config.Host = config.Endpoints.eps[0].host
 	}
+
+	if !config.Transport.isZero() {
+		config.HTTPClient, err = InitHTTPClient(config.Transport)
+		if err != nil {
+			return
+		}
+	}
+
+	config.clockSkew = &clockSkew{}
 	err = nil
 	return
 }
@@ -199,7 +345,14 @@ type ClientStruct struct {
 }
 
 // InitClient 初始化一个client
+// 直接设置了configs.Transport而HTTPClient为nil时，按Transport创建HTTPClient；创建失败时每个请求返回该错误
 func InitClient(configs ConfigStruct) ClientStruct {
+	if configs.clockSkew == nil {
+		configs.clockSkew = &clockSkew{}
+	}
+	if configs.HTTPClient == nil && !configs.Transport.isZero() {
+		configs.HTTPClient, configs.transportErr = InitHTTPClient(configs.Transport)
+	}
 	client := ClientStruct{
 		API: APIWrapper{configs: configs},
 	}
@@ -211,6 +364,84 @@ func (client ClientStruct) GetConfigs() ConfigStruct {
 	return client.API.configs
 }
 
+// WithSignatureTTL 返回一个使用指定签名有效期的client副本，用于单次或部分调用
+// param ttl: 访问密钥签名有效期，单位为秒s
+func (client ClientStruct) WithSignatureTTL(ttl int64) ClientStruct {
+	client.API.configs.SignatureTTL = ttl
+	return client
+}
+
+// WithProgress 返回一个使用指定进度回调的client副本，用于单次或部分传输
+// param fn: 传输进度回调函数，nil为不回调
+func (client ClientStruct) WithProgress(fn ProgressFunc) ClientStruct {
+	client.API.configs.Progress = fn
+	return client
+}
+
+// WithRateLimit 返回一个使用独立带宽限制的client副本，用于单次或部分传输
+// param bytesPerSec: 限制的带宽，byte/s，<=0为不限制
+// param burst: 允许的突发字节数，<=0时等于bytesPerSec
+func (client ClientStruct) WithRateLimit(bytesPerSec, burst int64) ClientStruct {
+	if bytesPerSec <= 0 {
+		return client.WithRateLimiter(nil)
+	}
+	return client.WithRateLimiter(InitRateLimiter(bytesPerSec, burst))
+}
+
+// WithRateLimiter 返回一个使用指定带宽限制器的client副本，多个client共享同一个限制器时共享带宽
+// param rl: 带宽限制器，nil为不限制
+func (client ClientStruct) WithRateLimiter(rl *RateLimiter) ClientStruct {
+	client.API.configs.RateLimiter = rl
+	return client
+}
+
+// WithCache 返回一个使用指定元数据缓存的client副本
+// param cache: 元数据和目录列表缓存，nil为不缓存
+func (client ClientStruct) WithCache(cache *MetadataCache) ClientStruct {
+	client.API.configs.Cache = cache
+	return client
+}
+
+// WithBlockCache 返回一个使用指定数据块缓存的client副本
+// param bc: 对象数据块的本地磁盘缓存，nil为不缓存
+func (client ClientStruct) WithBlockCache(bc *BlockCache) ClientStruct {
+	client.API.configs.BlockCache = bc
+	return client
+}
+
+// WithLogger 返回一个使用指定日志记录器的client副本
+// param logger: 记录每个api请求的日志，nil为不记录；Debug级别时记录请求和响应头
+func (client ClientStruct) WithLogger(logger *slog.Logger) ClientStruct {
+	client.API.configs.Logger = logger
+	return client
+}
+
+// WithMetrics 返回一个使用指定指标收集器的client副本
+// param m: 请求和传输指标收集，nil为不收集
+func (client ClientStruct) WithMetrics(m Metrics) ClientStruct {
+	client.API.configs.Metrics = m
+	return client
+}
+
+// WithTracer 返回一个使用指定追踪器的client副本
+// param tracer: 请求和传输的追踪，nil为不追踪
+func (client ClientStruct) WithTracer(tracer Tracer) ClientStruct {
+	client.API.configs.Tracer = tracer
+	return client
+}
+
+// WithSpan 返回一个以指定片段为父片段的client副本，用于将调用关联到调用者的追踪中
+// param span: 父片段
+func (client ClientStruct) WithSpan(span Span) ClientStruct {
+	client.API.configs.span = span
+	return client
+}
+
+// ClockSkew 获取检测到的服务器与本地的时钟偏差（服务器时间-本地时间）
+func (client ClientStruct) ClockSkew() time.Duration {
+	return client.API.configs.clockSkew.get()
+}
+
 // ObjMetadataReturn 对象或目录元数据返回结果
 type ObjMetadataReturn struct {
 	Results
@@ -224,20 +455,27 @@ type ObjMetadataReturn struct {
 // param pathName: 桶下路径
 func (client ClientStruct) GetMetadata(bucketName, pathName string) (*ObjMetadataReturn, error) {
 
+	cache := client.API.configs.Cache
+	key := metadataCacheKey(cacheScope(&client.API.configs), bucketName, pathName)
+	ret := ObjMetadataReturn{}
+	if cache.get(key, &ret) {
+		return &ret, nil
+	}
+
 	resp, err := client.API.GetMetadata(bucketName, pathName)
 	if err != nil {
 		return nil, err
 	}
 
-	ret := ObjMetadataReturn{}
 	if resp.StatusCode == 200 {
-		err2 := json.Unmarshal(resp.Bytes(), &ret)
+		err2 := decodeResponse(client.API.configs, resp.Bytes(), &ret)
 		if err2 != nil {
 			result := ResponseResult(resp)
 			ret.Results = *result
 		} else {
 			ret.Ok = true
 			ret.Code = resp.StatusCode
+			cache.set(key, bucketName, pathName, false, ret)
 		}
 		return &ret, nil
 	}
@@ -250,13 +488,36 @@ func (client ClientStruct) GetMetadata(bucketName, pathName string) (*ObjMetadat
 // UploadOneChunk 上传一个对象数据块
 // param bucketName: 桶名称
 // param objPathName: 桶下全路径对象名称
-// param offset: 数据块在对象中的字节偏移量
+// param offset: 数据块在对象中的字节偏移量；配置了Encryption时必须是EncryptionSegmentSize的整数倍
 // param chunk: 数据块
 func (client ClientStruct) UploadOneChunk(bucketName, objPathName string, offset int64, chunk []byte) (*Results, error) {
+	return client.uploadChunk(bucketName, objPathName, offset, chunk, nil)
+}
+
+// uploadChunk 上传一个对象数据块
+// param encKey: 配置了Encryption时同一次上传共用的数据密钥，见encryptedUploadOneChunk
+func (client ClientStruct) uploadChunk(bucketName, objPathName string, offset int64, chunk []byte, encKey **objectKey) (*Results, error) {
+
+	client, span := client.startSpan("UploadOneChunk", "bucket", bucketName, "object", objPathName, "offset", offset, "size", len(chunk))
+	var r *Results
+	var err error
+	if client.API.configs.Encryption != nil {
+		r, err = client.encryptedUploadOneChunk(bucketName, objPathName, offset, chunk, encKey)
+	} else {
+		r, err = client.uploadOneChunk(bucketName, objPathName, offset, chunk)
+	}
+	endResultSpan(span, r, err)
+	return r, err
+}
+
+// uploadOneChunk 上传一个对象数据块
+func (client ClientStruct) uploadOneChunk(bucketName, objPathName string, offset int64, chunk []byte) (*Results, error) {
 
 	dirPath, objName := CutPathAndName(objPathName)
 
 	resp, err := client.API.UploadOneChunk(bucketName, dirPath, objName, offset, chunk)
+	client.API.configs.Cache.invalidatePath(bucketName, objPathName)
+	client.API.configs.BlockCache.invalidate(bucketName, objPathName)
 	if err != nil {
 		return nil, err
 	}
@@ -266,6 +527,9 @@ func (client ClientStruct) UploadOneChunk(bucketName, objPathName string, offset
 		if result.CodeText == "" {
 			result.CodeText = "Successful to upload an chunk of object"
 		}
+		if m := client.API.configs.Metrics; m != nil {
+			m.AddBytes(true, int64(len(chunk)))
+		}
 	} else {
 		result.Ok = false
 		if result.CodeText == "" {
@@ -282,6 +546,40 @@ func (client ClientStruct) UploadOneChunk(bucketName, objPathName string, offset
 // param offset: 数据块在对象中的字节偏移量
 // param chunk: 数据块
 func (client ClientStruct) DownloadOneChunk(bucketName, objPathName string, offset int64, size int) (*ChunkReturn, error) {
+	return client.downloadChunk(bucketName, objPathName, offset, size, nil)
+}
+
+// downloadChunk 下载一个对象数据块
+// param dv: 同一次下载共用的对象版本，使用数据块缓存时只在首个数据块获取对象元数据；nil时每次获取
+func (client ClientStruct) downloadChunk(bucketName, objPathName string, offset int64, size int, dv *downloadVersion) (*ChunkReturn, error) {
+
+	client, span := client.startSpan("DownloadOneChunk", "bucket", bucketName, "object", objPathName, "offset", offset, "size", size)
+	var r *ChunkReturn
+	var err error
+	if client.API.configs.Encryption != nil {
+		r, err = client.encryptedDownloadOneChunk(bucketName, objPathName, offset, size, dv)
+	} else {
+		r, err = client.rawDownloadOneChunk(bucketName, objPathName, offset, size, dv)
+	}
+	if r != nil {
+		setSpanAttributes(span, "chunk_size", r.ChunkSize, "obj_size", r.ObjSize)
+		endResultSpan(span, &r.Results, err)
+	} else {
+		endSpan(span, err)
+	}
+	return r, err
+}
+
+// rawDownloadOneChunk 下载一个对象数据块，不解密
+func (client ClientStruct) rawDownloadOneChunk(bucketName, objPathName string, offset int64, size int, dv *downloadVersion) (*ChunkReturn, error) {
+	if client.API.configs.BlockCache != nil {
+		return client.cachedDownloadOneChunk(bucketName, objPathName, offset, size, dv)
+	}
+	return client.downloadOneChunk(bucketName, objPathName, offset, size)
+}
+
+// downloadOneChunk 从服务器下载一个对象数据块
+func (client ClientStruct) downloadOneChunk(bucketName, objPathName string, offset int64, size int) (*ChunkReturn, error) {
 
 	dirPath, objName := CutPathAndName(objPathName)
 
@@ -319,6 +617,9 @@ func (client ClientStruct) DownloadOneChunk(bucketName, objPathName string, offs
 		}
 	}
 	cr.Chunk = resp.Bytes()
+	if m := client.API.configs.Metrics; m != nil {
+		m.AddBytes(false, int64(len(cr.Chunk)))
+	}
 	if int64(len(cr.Chunk)) != cr.ChunkSize {
 		cr.Ok = false
 		cr.CodeText = "应返回的数据长度和实际下载的数据长度不一致"
@@ -332,6 +633,7 @@ type ObjReturn struct {
 	Results
 	Offset  int64 // 已完成对象上传或下载的偏移量
 	ObjSize int64 // 对象大小
+	Skipped bool  // 远端已有相同内容的对象，跳过了上传，见WithDedup
 }
 
 // IsDone 对象上传或下载是否完成
@@ -347,8 +649,20 @@ func (o ObjReturn) IsDone() bool {
 // param objPathName: 桶下全路径对象名称
 // param savePath: 下载的对象保存的目录路径
 // param saveFilename: 下载对象保存的新文件名，为空字符串，使用对象名称
-// param startOffset: 从对象的此偏移量处开始下载
+// param startOffset: 从对象的此偏移量处开始下载；配置了Compression时解压下载总是从头开始，startOffset必须为0
 func (client ClientStruct) DownLoadObject(bucketName, objPathName, savePath string, saveFilename string, startOffset int64) (*ObjReturn, error) {
+
+	client, span := client.startSpan("DownLoadObject", "bucket", bucketName, "object", objPathName, "start_offset", startOffset)
+	ret, err := client.downLoadObject(bucketName, objPathName, savePath, saveFilename, startOffset)
+	endObjSpan(span, ret, err)
+	return ret, err
+}
+
+// downLoadObject 下载一个对象
+func (client ClientStruct) downLoadObject(bucketName, objPathName, savePath string, saveFilename string, startOffset int64) (*ObjReturn, error) {
+	if client.API.configs.Compression != nil && startOffset > 0 {
+		return nil, errCompressionOffset
+	}
 	var offset int64
 	var readSize = 1024 * 1024 * 10 //10Mb
 	if startOffset < 0 {
@@ -376,8 +690,17 @@ func (client ClientStruct) DownLoadObject(bucketName, objPathName, savePath stri
 		}
 		fileName = saveFilename
 	}
+	if client.API.configs.Compression != nil {
+		// 保存的文件名在打开对象后确定，解压的对象去掉编码后缀
+		return client.downloadDecompressed(bucketName, objPathName, dirPath, saveFilename)
+	}
 	filePathName := filepath.Join(dirPath, fileName)
-	saveFile, err := os.Create(filePathName)
+	// 断点续传时保留已下载的数据
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_CREATE | os.O_WRONLY
+	}
+	saveFile, err := os.OpenFile(filePathName, flag, 0666)
 	if err != nil {
 		return nil, err
 	}
@@ -385,8 +708,11 @@ func (client ClientStruct) DownLoadObject(bucketName, objPathName, savePath stri
 
 	ret := &ObjReturn{ObjSize: -1}
 	var retErr error
+	var dv downloadVersion
+	pt := newProgressTracker(client.GetConfigs(), false, bucketName, objPathName, offset, -1)
+	pt.start()
 	for {
-		r, err := client.DownloadOneChunk(bucketName, objPathName, offset, readSize)
+		r, err := client.downloadChunk(bucketName, objPathName, offset, readSize, &dv)
 		if err != nil {
 			retErr = err
 			break
@@ -397,6 +723,7 @@ func (client ClientStruct) DownLoadObject(bucketName, objPathName, savePath stri
 			break
 		}
 		ret.ObjSize = r.ObjSize
+		pt.setTotal(ret.ObjSize)
 		if offset >= ret.ObjSize {
 			retErr = errors.New("offset超出了对象大小")
 			break
@@ -407,6 +734,7 @@ func (client ClientStruct) DownLoadObject(bucketName, objPathName, savePath stri
 			retErr = err
 			break
 		}
+		pt.chunkDone(offset, int64(writedSize))
 		offset += int64(writedSize)
 		if offset >= ret.ObjSize { // 下载完成
 			ret.CodeText = "download ok"
@@ -415,6 +743,7 @@ func (client ClientStruct) DownLoadObject(bucketName, objPathName, savePath stri
 		}
 	}
 	ret.Offset = offset
+	pt.finish(ret.Ok, progressErr(ret, retErr))
 	return ret, retErr
 }
 
@@ -422,8 +751,26 @@ func (client ClientStruct) DownLoadObject(bucketName, objPathName, savePath stri
 // param bucketName: 桶名称
 // param objPathName: 桶下全路径对象名称
 // param fileName: 要上传的文件路径
-// param startOffset: 从文件的此偏移量处开始上传
+// param startOffset: 从文件的此偏移量处开始上传；配置了Compression时压缩上传总是从头开始，startOffset必须为0
 func (client ClientStruct) UploadObject(bucketName, objPathName, fileName string, startOffset int64) (*ObjReturn, error) {
+
+	client, span := client.startSpan("UploadObject", "bucket", bucketName, "object", objPathName, "start_offset", startOffset)
+	ret, err := client.uploadObject(bucketName, objPathName, fileName, startOffset)
+	endObjSpan(span, ret, err)
+	return ret, err
+}
+
+// uploadObject 上传一个对象
+func (client ClientStruct) uploadObject(bucketName, objPathName, fileName string, startOffset int64) (*ObjReturn, error) {
+	if client.API.configs.Compression != nil && startOffset > 0 {
+		return nil, errCompressionOffset
+	}
+	if client.API.configs.Dedup != nil {
+		return client.dedupUploadObject(bucketName, objPathName, fileName, startOffset)
+	}
+	if client.API.configs.Compression != nil {
+		return client.uploadCompressedFile(bucketName, objPathName, fileName)
+	}
 	var offset int64
 	var readSize = 1024 * 1024 * 10 //10Mb
 	if startOffset < 0 {
@@ -431,6 +778,10 @@ func (client ClientStruct) UploadObject(bucketName, objPathName, fileName string
 	} else {
 		offset = startOffset
 	}
+	// 加密上传只能从分段边界处续传
+	if client.API.configs.Encryption != nil {
+		offset -= offset % EncryptionSegmentSize
+	}
 
 	file, err := os.Open(fileName)
 	if err != nil {
@@ -456,13 +807,16 @@ func (client ClientStruct) UploadObject(bucketName, objPathName, fileName string
 	// inputReader := bufio.NewReader(file)
 	readSize = 1024 * 1024 * 5    //5Mb
 	buf := make([]byte, readSize) //5Mb
+	var encKey *objectKey
+	pt := newProgressTracker(client.GetConfigs(), true, bucketName, objPathName, offset, ret.ObjSize)
+	pt.start()
 	for {
 		retSize, err := io.ReadFull(file, buf)
 		if (err != nil) && (err != io.ErrUnexpectedEOF) {
 			retErr = err
 			break
 		}
-		r, err := client.UploadOneChunk(bucketName, objPathName, offset, buf[0:retSize])
+		r, err := client.uploadChunk(bucketName, objPathName, offset, buf[0:retSize], &encKey)
 		if err != nil {
 			retErr = err
 			break
@@ -471,14 +825,25 @@ func (client ClientStruct) UploadObject(bucketName, objPathName, fileName string
 			ret.Results = *r
 			break
 		}
+		pt.chunkDone(offset, int64(retSize))
 		offset += int64(retSize)
 		if offset >= ret.ObjSize {
+			r, err := client.finishEncryptedUpload(bucketName, objPathName, offset, &encKey)
+			if err != nil {
+				retErr = err
+				break
+			}
+			if !r.Ok {
+				ret.Results = *r
+				break
+			}
 			ret.CodeText = "upload ok"
 			ret.Ok = true
 			break
 		}
 	}
 	ret.Offset = offset
+	pt.finish(ret.Ok, progressErr(ret, retErr))
 	return ret, retErr
 }
 
@@ -489,6 +854,8 @@ func (client ClientStruct) DeleteObject(bucketName, objPathName string) (*Result
 
 	dirPath, objName := CutPathAndName(objPathName)
 	resp, err := client.API.DeleteObject(bucketName, dirPath, objName)
+	client.API.configs.Cache.invalidatePath(bucketName, objPathName)
+	client.API.configs.BlockCache.invalidate(bucketName, objPathName)
 	if err != nil {
 		return nil, err
 	}
@@ -503,6 +870,18 @@ func (client ClientStruct) DeleteObject(bucketName, objPathName string) (*Result
 	return result, nil
 }
 
+// resetObject 删除已有的对象，分片上传不会截断对象，从头覆盖上传前调用；对象不存在视为成功
+func (client ClientStruct) resetObject(bucketName, objPathName string) (*Results, error) {
+	r, err := client.DeleteObject(bucketName, objPathName)
+	if err != nil {
+		return nil, err
+	}
+	if r.Code == 404 {
+		r.Ok = true
+	}
+	return r, nil
+}
+
 // MoveRenameReturn 移动重命名返回结构体
 type MoveRenameReturn struct {
 	Results
@@ -520,6 +899,10 @@ func (client ClientStruct) MoveRenameObject(bucketName, objPathName, moveTo, ren
 
 	dirPath, objName := CutPathAndName(objPathName)
 	resp, err := client.API.MoveRenameObject(bucketName, dirPath, objName, moveTo, rename)
+	cache := client.API.configs.Cache
+	cache.invalidatePath(bucketName, objPathName)
+	cache.invalidatePath(bucketName, movedPathName(dirPath, objName, moveTo, rename))
+	client.API.configs.BlockCache.invalidate(bucketName, objPathName)
 	if err != nil {
 		return nil, err
 	}
@@ -528,7 +911,7 @@ func (client ClientStruct) MoveRenameObject(bucketName, objPathName, moveTo, ren
 	if resp.StatusCode == 201 {
 		ret.Ok = true
 		ret.Code = resp.StatusCode
-		json.Unmarshal(resp.Bytes(), &ret)
+		decodeResponse(client.API.configs, resp.Bytes(), &ret)
 		return &ret, nil
 	}
 
@@ -537,6 +920,17 @@ func (client ClientStruct) MoveRenameObject(bucketName, objPathName, moveTo, ren
 	return &ret, nil
 }
 
+// movedPathName 移动或重命名后对象的全路径
+func movedPathName(dirPath, objName, moveTo, rename string) string {
+	if moveTo != "" {
+		dirPath = moveTo
+	}
+	if rename != "" {
+		objName = rename
+	}
+	return buildPath([]string{dirPath, objName})
+}
+
 // MoveObject 移动一个对象
 // param bucket_name: 桶名称
 // param objPathName: 桶下全路径对象名称
@@ -556,26 +950,17 @@ func (client ClientStruct) RenameObject(bucketName, objPathName, rename string)
 }
 
 // ObjectPermission 对象公有或私有访问权限设置
+// 只返回设置结果，需要分享信息时使用SetObjectPermission
 // param bucket_name: 桶名称
 // param objPathName: 桶下全路径对象名称
 // param share: 是否分享公开，用于设置对象公有或私有, true(公有)，false(私有)
 // param days: 对象公开分享天数(share=true时有效)，0表示永久公开，负数表示不公开
+//
+// Deprecated: 使用SetObjectPermission，与SetDirPermission、GetShareInfo返回相同的ShareReturn
 func (client ClientStruct) ObjectPermission(bucketName, objPathName string, share bool, days int) (*Results, error) {
 
-	dirPath, objName := CutPathAndName(objPathName)
-	resp, err := client.API.ObjectPermission(bucketName, dirPath, objName, share, days)
-	if err != nil {
-		return nil, err
-	}
-
-	result := ResponseResult(resp)
-	if resp.StatusCode != 200 {
-		result.Ok = false
-		if result.CodeText == "" {
-			result.CodeText = "Failed to share object"
-		}
-	}
-	return result, nil
+	r, _, err := client.setObjectPermission(bucketName, objPathName, share, days)
+	return r, err
 }
 
 // MakeDir 创建一个目录
@@ -677,6 +1062,7 @@ func (dir DirStruct) MakeDir() (*Results, error) {
 
 	API := APIWrapper{configs: dir.configs}
 	resp, err := API.MakeDir(dir.GetBucketName(), dir.GetDirPath(), dir.GetDirName())
+	dir.configs.Cache.invalidatePath(dir.GetBucketName(), dir.GetDirPathName())
 	if err != nil {
 		return nil, err
 	}
@@ -713,6 +1099,7 @@ func (dir DirStruct) DeleteDir() (*Results, error) {
 
 	API := APIWrapper{configs: dir.configs}
 	resp, err := API.DeleteDir(dir.GetBucketName(), dir.GetDirPath(), dir.GetDirName())
+	dir.configs.Cache.invalidateTree(dir.GetBucketName(), dir.GetDirPathName())
 	if err != nil {
 		return nil, err
 	}
@@ -776,13 +1163,36 @@ func (ldr ListDirReturn) FinalPageNum() int {
 //  	否则按服务器默认返回数据
 func (dir DirStruct) ListDirOnePage(offset, limit int) (*ListDirReturn, error) {
 
+	key := listCacheKey(cacheScope(&dir.configs), dir.GetBucketName(), dir.GetDirPathName(), offset, limit)
+	if ret, ok := dir.cachedPage(key); ok {
+		return ret, nil
+	}
+
 	API := APIWrapper{configs: dir.configs}
 	resp, err := API.ListDirOnePage(dir.GetBucketName(), dir.GetDirPath(), dir.GetDirName(), offset, limit)
 	if err != nil {
 		return nil, err
 	}
 
-	return dir.buildListDirReturn(resp)
+	ret, err := dir.buildListDirReturn(resp)
+	return dir.cachePage(key, ret, err)
+}
+
+// cachedPage 获取缓存的一页目录列表
+func (dir DirStruct) cachedPage(key string) (*ListDirReturn, bool) {
+	ret := ListDirReturn{}
+	if dir.configs.Cache.get(key, &ret) {
+		return &ret, true
+	}
+	return nil, false
+}
+
+// cachePage 缓存成功获取的一页目录列表
+func (dir DirStruct) cachePage(key string, ret *ListDirReturn, err error) (*ListDirReturn, error) {
+	if err == nil && ret.Ok {
+		dir.configs.Cache.set(key, dir.GetBucketName(), dir.GetDirPathName(), true, ret)
+	}
+	return ret, err
 }
 
 // buildListDirReturn 列举目录返回值构建
@@ -790,7 +1200,7 @@ func (dir DirStruct) buildListDirReturn(resp *grequests.Response) (*ListDirRetur
 
 	ret := ListDirReturn{}
 	if resp.StatusCode == 200 {
-		err2 := json.Unmarshal(resp.Bytes(), &ret)
+		err2 := decodeResponse(dir.configs, resp.Bytes(), &ret)
 		if err2 != nil {
 			return nil, err2
 		}
@@ -832,17 +1242,7 @@ func (dir *DirStruct) NextPage() (*ListDirReturn, error) {
 	}
 	url := dir.curPage.NextURL()
 
-	API := APIWrapper{configs: dir.configs}
-	r, err := API.ListDirOnePageByURL(url)
-	if err != nil {
-		return nil, err
-	}
-
-	ret, err := dir.buildListDirReturn(r)
-	if err == nil && r.Ok {
-		dir.curPage = ret
-	}
-	return ret, err
+	return dir.listPageByURL(url)
 }
 
 // PreviousPage 获取下一页数据
@@ -856,6 +1256,17 @@ func (dir *DirStruct) PreviousPage() (*ListDirReturn, error) {
 	}
 	url := dir.curPage.PreviousURL()
 
+	return dir.listPageByURL(url)
+}
+
+// listPageByURL 通过url获取一页数据，并设为当前页
+func (dir *DirStruct) listPageByURL(url string) (*ListDirReturn, error) {
+	key := listURLCacheKey(cacheScope(&dir.configs), url)
+	if ret, ok := dir.cachedPage(key); ok {
+		dir.curPage = ret
+		return ret, nil
+	}
+
 	API := APIWrapper{configs: dir.configs}
 	r, err := API.ListDirOnePageByURL(url)
 	if err != nil {
@@ -863,8 +1274,36 @@ func (dir *DirStruct) PreviousPage() (*ListDirReturn, error) {
 	}
 
 	ret, err := dir.buildListDirReturn(r)
+	ret, err = dir.cachePage(key, ret, err)
 	if err == nil && r.Ok {
 		dir.curPage = ret
 	}
 	return ret, err
 }
+
+// listPageSize 遍历目录时每页获取的数据量
+const listPageSize = 1000
+
+// listAll 获取目录下全部子目录和对象信息（不递归）
+func (dir *DirStruct) listAll() ([]MetadataStruct, error) {
+	r, err := dir.ListFirstPage(listPageSize)
+	if err != nil {
+		return nil, err
+	}
+	if !r.Ok {
+		return nil, r.Results
+	}
+
+	files := r.Files
+	for r.HasNext() {
+		r, err = dir.NextPage()
+		if err != nil {
+			return nil, err
+		}
+		if !r.Ok {
+			return nil, r.Results
+		}
+		files = append(files, r.Files...)
+	}
+	return files, nil
+}
@@ -0,0 +1,77 @@
+package goharbor
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"goharbor/grequests"
+)
+
+// redactedHeaders 日志中不记录值的请求头
+var redactedHeaders = map[string]struct{}{
+	"Authorization":       {},
+	"Proxy-Authorization": {},
+	"Cookie":              {},
+	"Set-Cookie":          {},
+}
+
+// headerAttrs 将http头转换为日志属性，敏感头的值被隐藏
+func headerAttrs(h http.Header) []interface{} {
+	attrs := make([]interface{}, 0, len(h))
+	for k, v := range h {
+		if _, ok := redactedHeaders[http.CanonicalHeaderKey(k)]; ok {
+			attrs = append(attrs, slog.String(k, "REDACTED"))
+			continue
+		}
+		attrs = append(attrs, slog.String(k, strings.Join(v, ", ")))
+	}
+	return attrs
+}
+
+// logRequest 记录一次api请求
+// 网络错误记录为Error级别，非2xx响应为Warn级别，其余为Info级别；Debug级别时附带请求和响应头
+func logRequest(logger *slog.Logger, method, url string, resp *grequests.Response, err error, attempts int, latency time.Duration) {
+	if logger == nil {
+		return
+	}
+
+	attrs := []interface{}{
+		slog.String("method", method),
+		slog.String("url", url),
+		slog.Duration("latency", latency),
+		slog.Int("attempts", attempts),
+	}
+
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	var raw *http.Response
+	if resp != nil && resp.RawResponse != nil {
+		raw = resp.RawResponse
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+		if raw.Request != nil {
+			attrs = append(attrs, slog.Int64("request_bytes", raw.Request.ContentLength))
+		}
+		attrs = append(attrs, slog.Int64("response_bytes", raw.ContentLength))
+		if !resp.Ok {
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.String("error", ResponseResult(resp).CodeText))
+		}
+	}
+
+	ctx := context.Background()
+	if raw != nil && logger.Enabled(ctx, slog.LevelDebug) {
+		if raw.Request != nil {
+			attrs = append(attrs, slog.Group("request_headers", headerAttrs(raw.Request.Header)...))
+		}
+		attrs = append(attrs, slog.Group("response_headers", headerAttrs(raw.Header)...))
+	}
+
+	logger.Log(ctx, level, "evharbor api request", attrs...)
+}
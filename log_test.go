@@ -0,0 +1,38 @@
+package goharbor
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_logRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		w.Write([]byte(`{"code_text": "对象不存在"}`))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := testClient(server.URL).WithLogger(logger)
+
+	r, err := client.DeleteObject("b", "a/x.txt")
+	if err != nil || r.Code != 404 {
+		t.Fatalf("DeleteObject() = %+v, %v", r, err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{`"level":"WARN"`, `"method":"DELETE"`, `"status":404`, `"error":"对象不存在"`, `"Authorization":"REDACTED"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output missing %s: %s", want, out)
+		}
+	}
+	if strings.Contains(out, "evhb-auth") {
+		t.Errorf("log output leaks Authorization header: %s", out)
+	}
+}
@@ -0,0 +1,170 @@
+package goharbor
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Permission 对象或目录的访问权限
+type Permission int
+
+const (
+	// PermissionUnknown 未知或服务器未返回
+	PermissionUnknown Permission = iota
+	// PermissionPrivate 私有
+	PermissionPrivate
+	// PermissionPublicRead 公有（只读）
+	PermissionPublicRead
+	// PermissionPublicReadWrite 公有（可读写）
+	PermissionPublicReadWrite
+)
+
+// String 实现fmt.Stringer
+func (p Permission) String() string {
+	switch p {
+	case PermissionPrivate:
+		return "private"
+	case PermissionPublicRead:
+		return "public-read"
+	case PermissionPublicReadWrite:
+		return "public-read-write"
+	}
+	return "unknown"
+}
+
+// IsPublic 是否公开访问
+func (p Permission) IsPublic() bool {
+	return p == PermissionPublicRead || p == PermissionPublicReadWrite
+}
+
+// ParsePermission 解析服务器返回的访问权限描述，如 "私有"、"公有"、"公有（读写）"
+func ParsePermission(s string) Permission {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case s == "":
+		return PermissionUnknown
+	case strings.Contains(s, "私有") || strings.Contains(s, "private"):
+		return PermissionPrivate
+	case strings.Contains(s, "读写") || strings.Contains(s, "write"):
+		return PermissionPublicReadWrite
+	case strings.Contains(s, "公有") || strings.Contains(s, "公开") || strings.Contains(s, "public"):
+		return PermissionPublicRead
+	}
+	return PermissionUnknown
+}
+
+// metadataTimeLayouts 服务器可能返回的时间格式
+var metadataTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// ParseMetadataTime 解析服务器返回的时间字符串，没有时区信息时按本地时区解析
+func ParseMetadataTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	var err error
+	for _, layout := range metadataTimeLayouts {
+		var t time.Time
+		t, err = time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，解码后解析时间和权限字段
+func (m *MetadataStruct) UnmarshalJSON(data []byte) error {
+	type raw MetadataStruct
+	if err := json.Unmarshal(data, (*raw)(m)); err != nil {
+		return err
+	}
+	m.parse()
+	return nil
+}
+
+// parse 根据原始字符串字段填充类型化字段
+func (m *MetadataStruct) parse() {
+	m.Uploaded, _ = ParseMetadataTime(m.UploadTime)
+	m.Updated, _ = ParseMetadataTime(m.UpdateTime)
+	m.Permission = ParsePermission(m.AccessPermission)
+}
+
+// IsDir 是否是目录
+func (m MetadataStruct) IsDir() bool {
+	return !m.FileOrDir
+}
+
+// IsObject 是否是对象
+func (m MetadataStruct) IsObject() bool {
+	return m.FileOrDir
+}
+
+// ModTime 最后修改时间，服务器未返回修改时间时为上传时间
+func (m MetadataStruct) ModTime() time.Time {
+	if !m.Updated.IsZero() {
+		return m.Updated
+	}
+	return m.Uploaded
+}
+
+// HumanSize 可读的大小，如 "1.5 MiB"
+func (m MetadataStruct) HumanSize() string {
+	const unit = 1024
+	if m.Size < unit {
+		return strconv.FormatUint(m.Size, 10) + " B"
+	}
+	div, exp := uint64(unit), 0
+	for n := m.Size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return strconv.FormatFloat(float64(m.Size)/float64(div), 'f', 1, 64) + " " + string("KMGTPE"[exp]) + "iB"
+}
+
+// FileInfo 转换为os.FileInfo，Sys()返回MetadataStruct
+func (m MetadataStruct) FileInfo() os.FileInfo {
+	return metadataFileInfo{m}
+}
+
+// metadataFileInfo 实现os.FileInfo
+type metadataFileInfo struct {
+	m MetadataStruct
+}
+
+func (fi metadataFileInfo) Name() string {
+	if fi.m.Name != "" {
+		return fi.m.Name
+	}
+	_, name := CutPathAndName(strings.TrimSuffix(fi.m.PathName, "/"))
+	return name
+}
+
+func (fi metadataFileInfo) Size() int64 {
+	return int64(fi.m.Size)
+}
+
+func (fi metadataFileInfo) Mode() os.FileMode {
+	if fi.m.IsDir() {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi metadataFileInfo) ModTime() time.Time {
+	return fi.m.ModTime()
+}
+
+func (fi metadataFileInfo) IsDir() bool {
+	return fi.m.IsDir()
+}
+
+func (fi metadataFileInfo) Sys() interface{} {
+	return fi.m
+}
@@ -0,0 +1,60 @@
+package goharbor
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_MetadataStructUnmarshal(t *testing.T) {
+	data := []byte(`{"na": "a/b/x.csv", "name": "x.csv", "fod": true, "si": 1572864,
+		"ult": "2020-05-13T17:21:05.123456+08:00", "upt": "2020-05-14 08:00:00",
+		"access_permission": "公有（读写）"}`)
+	m := MetadataStruct{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	cst := time.FixedZone("CST", 8*3600)
+	if !m.Uploaded.Equal(time.Date(2020, 5, 13, 17, 21, 5, 123456000, cst)) {
+		t.Errorf("Uploaded = %v", m.Uploaded)
+	}
+	if !m.Updated.Equal(time.Date(2020, 5, 14, 8, 0, 0, 0, time.Local)) || !m.ModTime().Equal(m.Updated) {
+		t.Errorf("Updated = %v, ModTime = %v", m.Updated, m.ModTime())
+	}
+	if m.Permission != PermissionPublicReadWrite || !m.Permission.IsPublic() {
+		t.Errorf("Permission = %v", m.Permission)
+	}
+	if !m.IsObject() || m.IsDir() || m.HumanSize() != "1.5 MiB" {
+		t.Errorf("IsObject = %v, HumanSize = %s", m.IsObject(), m.HumanSize())
+	}
+
+	var fi os.FileInfo = m.FileInfo()
+	if fi.Name() != "x.csv" || fi.Size() != 1572864 || fi.IsDir() || fi.Mode()&os.ModeDir != 0 || !fi.ModTime().Equal(m.Updated) {
+		t.Errorf("FileInfo = %v %v %v %v", fi.Name(), fi.Size(), fi.Mode(), fi.ModTime())
+	}
+
+	// 缓存等经过json往返后类型化字段保持一致
+	data, _ = json.Marshal(m)
+	m2 := MetadataStruct{}
+	json.Unmarshal(data, &m2)
+	if !m2.Uploaded.Equal(m.Uploaded) || m2.Permission != m.Permission {
+		t.Errorf("round trip = %+v", m2)
+	}
+}
+
+func Test_ParsePermission(t *testing.T) {
+	cases := map[string]Permission{
+		"":                  PermissionUnknown,
+		"私有":                PermissionPrivate,
+		"公有":                PermissionPublicRead,
+		"public-read-write": PermissionPublicReadWrite,
+		"Private":           PermissionPrivate,
+	}
+	for s, want := range cases {
+		if got := ParsePermission(s); got != want {
+			t.Errorf("ParsePermission(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
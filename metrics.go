@@ -0,0 +1,239 @@
+package goharbor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics 客户端指标收集接口，实现需可被多个goroutine并发调用
+type Metrics interface {
+	// ObserveRequest 一次api请求完成，status为0表示网络错误
+	ObserveRequest(endpoint, method string, status int, latency time.Duration)
+	// AddRetries 一次api请求发生了n次重试
+	AddRetries(endpoint string, n int)
+	// AddBytes 上传或下载了n个字节的对象数据
+	AddBytes(upload bool, n int64)
+	// TransferStarted 一个对象上传或下载开始
+	TransferStarted(upload bool)
+	// TransferFinished 一个对象上传或下载结束
+	TransferFinished(upload bool, ok bool)
+}
+
+// requestEndpoint 从api url中获取端点名称，如 obj、dir、metadata
+func requestEndpoint(configs ConfigStruct, userURL string) string {
+	u, err := url.Parse(userURL)
+	if err != nil {
+		return "unknown"
+	}
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segs) >= 3 && segs[0] == "api" && segs[1] == configs.Version {
+		return segs[2]
+	}
+	return "unknown"
+}
+
+// observeRequest 记录一次api请求的指标
+func observeRequest(configs ConfigStruct, method, url string, status, attempts int, latency time.Duration) {
+	m := configs.Metrics
+	if m == nil {
+		return
+	}
+	endpoint := requestEndpoint(configs, url)
+	m.ObserveRequest(endpoint, method, status, latency)
+	if attempts > 1 {
+		m.AddRetries(endpoint, attempts-1)
+	}
+}
+
+// defaultLatencyBuckets 请求耗时直方图的默认分桶上界，单位为秒s
+var defaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// histogram 请求耗时直方图
+type histogram struct {
+	counts []uint64 // 与分桶上界一一对应，非累计
+	count  uint64
+	sum    float64
+}
+
+// MetricsRegistry Metrics的内置实现，可导出Prometheus文本格式
+type MetricsRegistry struct {
+	mu        sync.Mutex
+	buckets   []float64
+	requests  map[[3]string]uint64 // endpoint, method, status
+	latencies map[string]*histogram
+	retries   map[string]uint64
+	bytes     map[string]uint64
+	inFlight  map[string]int64
+	transfers map[[2]string]uint64 // direction, result
+}
+
+// InitMetricsRegistry 初始化一个指标收集器
+// param buckets: 请求耗时直方图的分桶上界，单位为秒s，nil使用默认分桶
+func InitMetricsRegistry(buckets []float64) *MetricsRegistry {
+	if len(buckets) == 0 {
+		buckets = defaultLatencyBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &MetricsRegistry{
+		buckets:   b,
+		requests:  make(map[[3]string]uint64),
+		latencies: make(map[string]*histogram),
+		retries:   make(map[string]uint64),
+		bytes:     make(map[string]uint64),
+		inFlight:  make(map[string]int64),
+		transfers: make(map[[2]string]uint64),
+	}
+}
+
+func direction(upload bool) string {
+	if upload {
+		return "upload"
+	}
+	return "download"
+}
+
+// ObserveRequest 实现Metrics
+func (mr *MetricsRegistry) ObserveRequest(endpoint, method string, status int, latency time.Duration) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	mr.requests[[3]string{endpoint, method, strconv.Itoa(status)}]++
+	h, ok := mr.latencies[endpoint]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(mr.buckets))}
+		mr.latencies[endpoint] = h
+	}
+	sec := latency.Seconds()
+	for i, le := range mr.buckets {
+		if sec <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += sec
+}
+
+// AddRetries 实现Metrics
+func (mr *MetricsRegistry) AddRetries(endpoint string, n int) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.retries[endpoint] += uint64(n)
+}
+
+// AddBytes 实现Metrics
+func (mr *MetricsRegistry) AddBytes(upload bool, n int64) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.bytes[direction(upload)] += uint64(n)
+}
+
+// TransferStarted 实现Metrics
+func (mr *MetricsRegistry) TransferStarted(upload bool) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.inFlight[direction(upload)]++
+}
+
+// TransferFinished 实现Metrics
+func (mr *MetricsRegistry) TransferFinished(upload bool, ok bool) {
+	result := "failed"
+	if ok {
+		result = "ok"
+	}
+
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.inFlight[direction(upload)]--
+	mr.transfers[[2]string{direction(upload), result}]++
+}
+
+// labels 格式化Prometheus标签
+func labels(kv ...string) string {
+	parts := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		parts = append(parts, kv[i]+"="+strconv.Quote(kv[i+1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// WritePrometheus 以Prometheus文本格式输出全部指标
+func (mr *MetricsRegistry) WritePrometheus(w io.Writer) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	var lines []string
+	emit := func(name, help, typ string) {
+		sort.Strings(lines)
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, l := range lines {
+			fmt.Fprintln(bw, l)
+		}
+		lines = lines[:0]
+	}
+
+	for k, v := range mr.requests {
+		lines = append(lines, fmt.Sprintf("goharbor_requests_total%s %d", labels("endpoint", k[0], "method", k[1], "status", k[2]), v))
+	}
+	emit("goharbor_requests_total", "Total EVHarbor API requests by endpoint, method and status (0 means network error).", "counter")
+
+	endpoints := make([]string, 0, len(mr.latencies))
+	for e := range mr.latencies {
+		endpoints = append(endpoints, e)
+	}
+	sort.Strings(endpoints)
+	fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", "goharbor_request_duration_seconds", "EVHarbor API request latency.", "goharbor_request_duration_seconds", "histogram")
+	for _, e := range endpoints {
+		h := mr.latencies[e]
+		var cum uint64
+		for i, le := range mr.buckets {
+			cum += h.counts[i]
+			fmt.Fprintf(bw, "goharbor_request_duration_seconds_bucket%s %d\n", labels("endpoint", e, "le", formatFloat(le)), cum)
+		}
+		fmt.Fprintf(bw, "goharbor_request_duration_seconds_bucket%s %d\n", labels("endpoint", e, "le", "+Inf"), h.count)
+		fmt.Fprintf(bw, "goharbor_request_duration_seconds_sum%s %s\n", labels("endpoint", e), formatFloat(h.sum))
+		fmt.Fprintf(bw, "goharbor_request_duration_seconds_count%s %d\n", labels("endpoint", e), h.count)
+	}
+
+	for k, v := range mr.retries {
+		lines = append(lines, fmt.Sprintf("goharbor_request_retries_total%s %d", labels("endpoint", k), v))
+	}
+	emit("goharbor_request_retries_total", "Total EVHarbor API request retries.", "counter")
+
+	for k, v := range mr.bytes {
+		lines = append(lines, fmt.Sprintf("goharbor_transfer_bytes_total%s %d", labels("direction", k), v))
+	}
+	emit("goharbor_transfer_bytes_total", "Total object bytes uploaded or downloaded.", "counter")
+
+	for k, v := range mr.inFlight {
+		lines = append(lines, fmt.Sprintf("goharbor_transfers_in_flight%s %d", labels("direction", k), v))
+	}
+	emit("goharbor_transfers_in_flight", "Object transfers currently in progress.", "gauge")
+
+	for k, v := range mr.transfers {
+		lines = append(lines, fmt.Sprintf("goharbor_transfers_total%s %d", labels("direction", k[0], "result", k[1]), v))
+	}
+	emit("goharbor_transfers_total", "Total finished object transfers by result.", "counter")
+
+	return bw.Flush()
+}
+
+// ServeHTTP 实现http.Handler，以Prometheus文本格式输出全部指标
+func (mr *MetricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	mr.WritePrometheus(w)
+}
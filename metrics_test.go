@@ -0,0 +1,62 @@
+package goharbor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_requestEndpoint(t *testing.T) {
+	configs := GetDefaultConfig()
+	builder := apiBuilderStruct{configs: configs}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: builder.buildObjAPI("b", "a", "x.txt", nil), want: "obj"},
+		{url: builder.buildMetadataAPI("b", "a", nil), want: "metadata"},
+		{url: "https://obs.casearth.cn/other/", want: "unknown"},
+	}
+	for _, tt := range tests {
+		if got := requestEndpoint(configs, tt.url); got != tt.want {
+			t.Errorf("requestEndpoint(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestMetricsRegistry_WritePrometheus(t *testing.T) {
+	mr := InitMetricsRegistry([]float64{0.1, 1})
+	mr.ObserveRequest("obj", "POST", 200, 50*time.Millisecond)
+	mr.ObserveRequest("obj", "POST", 200, 500*time.Millisecond)
+	mr.ObserveRequest("obj", "GET", 0, 2*time.Second)
+	mr.AddRetries("obj", 1)
+	mr.AddBytes(true, 1024)
+	mr.TransferStarted(true)
+	mr.TransferStarted(false)
+	mr.TransferFinished(false, false)
+
+	var buf bytes.Buffer
+	if err := mr.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`goharbor_requests_total{endpoint="obj",method="POST",status="200"} 2`,
+		`goharbor_requests_total{endpoint="obj",method="GET",status="0"} 1`,
+		`goharbor_request_duration_seconds_bucket{endpoint="obj",le="0.1"} 1`,
+		`goharbor_request_duration_seconds_bucket{endpoint="obj",le="1"} 2`,
+		`goharbor_request_duration_seconds_bucket{endpoint="obj",le="+Inf"} 3`,
+		`goharbor_request_duration_seconds_count{endpoint="obj"} 3`,
+		`goharbor_request_retries_total{endpoint="obj"} 1`,
+		`goharbor_transfer_bytes_total{direction="upload"} 1024`,
+		`goharbor_transfers_in_flight{direction="upload"} 1`,
+		`goharbor_transfers_in_flight{direction="download"} 0`,
+		`goharbor_transfers_total{direction="download",result="failed"} 1`,
+		"# TYPE goharbor_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package goharbor
+
+import (
+	"goharbor/grequests"
+)
+
+// APIRequest 一个已签名、即将发送的api请求
+type APIRequest struct {
+	Method  string                    // 请求方法
+	URL     string                    // 已编码的url
+	Options *grequests.RequestOptions // 请求选项，Headers中已包含Authorization
+}
+
+// Handler 发送一个api请求，未返回错误时响应不能为nil
+type Handler func(req *APIRequest) (*grequests.Response, error)
+
+// Middleware 请求中间件，在签名之后、发送之前处理请求，可修改请求、替换响应或不调用next直接返回
+type Middleware func(next Handler) Handler
+
+// sendRequest 中间件链最内层的Handler，实际发送请求
+func sendRequest(req *APIRequest) (*grequests.Response, error) {
+	return grequests.DoRegularRequest(req.Method, req.URL, req.Options)
+}
+
+// chainMiddlewares 构建中间件链，先添加的中间件在外层
+func chainMiddlewares(mws []Middleware, h Handler) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// WithMiddleware 返回一个追加了请求中间件的client副本，先添加的中间件在外层
+// param mws: 请求中间件
+func (client ClientStruct) WithMiddleware(mws ...Middleware) ClientStruct {
+	configs := &client.API.configs
+	all := make([]Middleware, 0, len(configs.Middlewares)+len(mws))
+	all = append(all, configs.Middlewares...)
+	configs.Middlewares = append(all, mws...)
+	return client
+}
+
+// HeaderMiddleware 为每个请求添加自定义请求头的中间件
+// param headers: 请求头
+func HeaderMiddleware(headers map[string]string) Middleware {
+	return func(next Handler) Handler {
+		return func(req *APIRequest) (*grequests.Response, error) {
+			if req.Options.Headers == nil {
+				req.Options.Headers = map[string]string{}
+			}
+			for k, v := range headers {
+				req.Options.Headers[k] = v
+			}
+			return next(req)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package goharbor
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goharbor/grequests"
+)
+
+func Test_WithMiddleware(t *testing.T) {
+	var gotHeader, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get("X-Team")
+		gotAuth = r.Header.Get("Authorization")
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	client := testClient(server.URL)
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(req *APIRequest) (*grequests.Response, error) {
+				order = append(order, name+">")
+				resp, err := next(req)
+				order = append(order, "<"+name)
+				return resp, err
+			}
+		}
+	}
+	c := client.WithMiddleware(trace("a"), HeaderMiddleware(map[string]string{"X-Team": "storage"})).WithMiddleware(trace("b"))
+
+	r, err := c.DeleteObject("b", "a/x.txt")
+	if err != nil || !r.Ok {
+		t.Fatalf("DeleteObject() = %+v, %v", r, err)
+	}
+	if gotHeader != "storage" || gotAuth == "" {
+		t.Errorf("headers = %q, %q", gotHeader, gotAuth)
+	}
+	if strings.Join(order, " ") != "a> b> <b <a" {
+		t.Errorf("order = %v", order)
+	}
+
+	// 原client不受影响
+	order = nil
+	gotHeader = ""
+	if _, err := client.DeleteObject("b", "a/x.txt"); err != nil || gotHeader != "" || order != nil {
+		t.Errorf("original client used middlewares: %q %v %v", gotHeader, order, err)
+	}
+
+	// 中间件可以不调用next直接返回错误
+	fault := errors.New("injected")
+	c = client.WithMiddleware(func(next Handler) Handler {
+		return func(req *APIRequest) (*grequests.Response, error) {
+			return nil, fault
+		}
+	})
+	if _, err := c.DeleteObject("b", "a/x.txt"); err == nil {
+		t.Error("expected injected error")
+	}
+
+	// 中间件既未返回响应也未返回错误
+	c = client.WithMiddleware(func(next Handler) Handler {
+		return func(req *APIRequest) (*grequests.Response, error) {
+			return nil, nil
+		}
+	})
+	if _, err := c.DeleteObject("b", "a/x.txt"); err == nil {
+		t.Error("expected error for nil response")
+	}
+}
@@ -0,0 +1,265 @@
+package goharbor
+
+import (
+	"sync"
+	"time"
+)
+
+// ProgressEvent 传输进度事件类型
+type ProgressEvent uint8
+
+const (
+	// ProgressStarted 传输开始
+	ProgressStarted ProgressEvent = iota
+	// ProgressChunkDone 一个数据块传输完成
+	ProgressChunkDone
+	// ProgressCompleted 传输完成
+	ProgressCompleted
+	// ProgressFailed 传输失败或中断
+	ProgressFailed
+)
+
+// String 事件名称
+func (e ProgressEvent) String() string {
+	switch e {
+	case ProgressStarted:
+		return "started"
+	case ProgressChunkDone:
+		return "chunk_done"
+	case ProgressCompleted:
+		return "completed"
+	case ProgressFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// Progress 对象上传或下载的进度信息
+type Progress struct {
+	Event       ProgressEvent
+	Upload      bool          // 上传（true），下载（false）
+	BucketName  string        // 桶名称
+	ObjPathName string        // 桶下全路径对象名称
+	ChunkOffset int64         // 最近完成的数据块偏移量
+	ChunkSize   int64         // 最近完成的数据块大小
+	Done        int64         // 已完成字节数（含断点续传之前已完成的部分）
+	Total       int64         // 对象总字节数，未知时为-1
+	Rate        float64       // 本次传输的平均速率，byte/s
+	ETA         time.Duration // 预计剩余时间，无法估计时为-1
+	Err         error         // 失败时的错误信息
+}
+
+// Percent 完成百分比，总大小未知时返回-1
+func (p Progress) Percent() float64 {
+	if p.Total < 0 {
+		return -1
+	}
+	if p.Total == 0 {
+		return 100
+	}
+	return float64(p.Done) * 100 / float64(p.Total)
+}
+
+// ProgressFunc 传输进度回调函数，在对象上传下载的数据块循环中被同步调用，不应长时间阻塞
+type ProgressFunc func(p Progress)
+
+// progressTracker 单个对象传输的进度计算，同时向Metrics报告传输的开始和结束
+type progressTracker struct {
+	fn          ProgressFunc
+	metrics     Metrics
+	p           Progress
+	startOffset int64
+	startTime   time.Time
+}
+
+// newProgressTracker 创建一个进度跟踪器，未配置进度回调和Metrics时所有方法为空操作
+func newProgressTracker(configs ConfigStruct, upload bool, bucketName, objPathName string, offset, total int64) *progressTracker {
+	if configs.Progress == nil && configs.Metrics == nil {
+		return nil
+	}
+	return &progressTracker{
+		fn:      configs.Progress,
+		metrics: configs.Metrics,
+		p: Progress{
+			Upload:      upload,
+			BucketName:  bucketName,
+			ObjPathName: objPathName,
+			Done:        offset,
+			Total:       total,
+			ETA:         -1,
+		},
+		startOffset: offset,
+		startTime:   time.Now(),
+	}
+}
+
+// emit 计算速率和剩余时间并回调
+func (pt *progressTracker) emit(event ProgressEvent) {
+	pt.p.Event = event
+	elapsed := time.Since(pt.startTime).Seconds()
+	if elapsed > 0 {
+		pt.p.Rate = float64(pt.p.Done-pt.startOffset) / elapsed
+	}
+	pt.p.ETA = -1
+	if pt.p.Total >= 0 && pt.p.Rate > 0 {
+		pt.p.ETA = time.Duration(float64(pt.p.Total-pt.p.Done) / pt.p.Rate * float64(time.Second))
+	}
+	if pt.fn != nil {
+		pt.fn(pt.p)
+	}
+}
+
+// start 传输开始
+func (pt *progressTracker) start() {
+	if pt == nil {
+		return
+	}
+	if pt.metrics != nil {
+		pt.metrics.TransferStarted(pt.p.Upload)
+	}
+	pt.emit(ProgressStarted)
+}
+
+// setTotal 设置对象总大小（下载时首个数据块返回后才能获知）
+func (pt *progressTracker) setTotal(total int64) {
+	if pt == nil {
+		return
+	}
+	pt.p.Total = total
+}
+
+// chunkDone 一个数据块传输完成
+func (pt *progressTracker) chunkDone(offset, size int64) {
+	if pt == nil {
+		return
+	}
+	pt.p.ChunkOffset = offset
+	pt.p.ChunkSize = size
+	pt.p.Done = offset + size
+	pt.emit(ProgressChunkDone)
+}
+
+// finish 传输结束
+// param ok: 是否传输完成
+// param err: 失败时的错误信息
+func (pt *progressTracker) finish(ok bool, err error) {
+	if pt == nil {
+		return
+	}
+	if pt.metrics != nil {
+		pt.metrics.TransferFinished(pt.p.Upload, ok)
+	}
+	if ok {
+		pt.emit(ProgressCompleted)
+		return
+	}
+	pt.p.Err = err
+	pt.emit(ProgressFailed)
+}
+
+// AggregateProgress 多个对象传输的汇总进度
+type AggregateProgress struct {
+	Transfers int           // 传输总数
+	Active    int           // 进行中的传输数
+	Completed int           // 已完成的传输数
+	Failed    int           // 失败的传输数
+	Done      int64         // 已完成字节数
+	Total     int64         // 总字节数，有任一传输大小未知时为-1
+	Rate      float64       // 进行中传输的速率之和，byte/s
+	ETA       time.Duration // 预计剩余时间，无法估计时为-1
+}
+
+// add 计入一个传输的进度
+func (agg *AggregateProgress) add(p Progress) {
+	agg.Transfers++
+	switch p.Event {
+	case ProgressCompleted:
+		agg.Completed++
+	case ProgressFailed:
+		agg.Failed++
+	default:
+		agg.Active++
+		agg.Rate += p.Rate
+	}
+	agg.Done += p.Done
+	if p.Total < 0 || agg.Total < 0 {
+		agg.Total = -1
+	} else {
+		agg.Total += p.Total
+	}
+}
+
+// ProgressAggregator 汇总多个并发传输的进度，可安全地被多个goroutine使用
+// 结束的传输只保留在汇总数中，长时间运行时内存不随传输数增长
+type ProgressAggregator struct {
+	mu        sync.Mutex
+	transfers map[string]Progress // 进行中的传输
+	finished  AggregateProgress   // 已结束的传输的汇总
+	onUpdate  func(AggregateProgress)
+}
+
+// InitProgressAggregator 初始化一个进度汇总器
+// param onUpdate: 每次有传输进度更新时回调汇总进度，可以为nil
+func InitProgressAggregator(onUpdate func(AggregateProgress)) *ProgressAggregator {
+	return &ProgressAggregator{
+		transfers: make(map[string]Progress),
+		onUpdate:  onUpdate,
+	}
+}
+
+// Track 接收一个传输的进度，可直接作为ProgressFunc使用
+func (pa *ProgressAggregator) Track(p Progress) {
+	key := buildPath([]string{p.BucketName, p.ObjPathName})
+	if p.Upload {
+		key = "upload:" + key
+	} else {
+		key = "download:" + key
+	}
+
+	pa.mu.Lock()
+	switch p.Event {
+	case ProgressCompleted, ProgressFailed:
+		delete(pa.transfers, key)
+		pa.finished.add(p)
+	default:
+		pa.transfers[key] = p
+	}
+	snapshot := pa.snapshot()
+	pa.mu.Unlock()
+
+	if pa.onUpdate != nil {
+		pa.onUpdate(snapshot)
+	}
+}
+
+// Func 返回可配置到client的进度回调函数
+func (pa *ProgressAggregator) Func() ProgressFunc {
+	return pa.Track
+}
+
+// Snapshot 获取当前的汇总进度
+func (pa *ProgressAggregator) Snapshot() AggregateProgress {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	return pa.snapshot()
+}
+
+func (pa *ProgressAggregator) snapshot() AggregateProgress {
+	agg := pa.finished
+	agg.ETA = -1
+	for _, p := range pa.transfers {
+		agg.add(p)
+	}
+	if agg.Total >= 0 && agg.Rate > 0 {
+		agg.ETA = time.Duration(float64(agg.Total-agg.Done) / agg.Rate * float64(time.Second))
+	}
+	return agg
+}
+
+// progressErr 传输失败时回调的错误信息
+func progressErr(ret *ObjReturn, err error) error {
+	if err != nil || ret.Ok {
+		return err
+	}
+	return ret.Results
+}
@@ -0,0 +1,96 @@
+package goharbor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestProgressAggregator(t *testing.T) {
+	var last AggregateProgress
+	pa := InitProgressAggregator(func(agg AggregateProgress) {
+		last = agg
+	})
+
+	pa.Track(Progress{Event: ProgressChunkDone, Upload: true, BucketName: "b", ObjPathName: "a.txt", Done: 50, Total: 100, Rate: 10})
+	pa.Track(Progress{Event: ProgressCompleted, Upload: true, BucketName: "b", ObjPathName: "c.txt", Done: 20, Total: 20, Rate: 5})
+	pa.Track(Progress{Event: ProgressChunkDone, Upload: true, BucketName: "b", ObjPathName: "a.txt", Done: 80, Total: 100, Rate: 10})
+
+	if last.Transfers != 2 || last.Active != 1 || last.Completed != 1 {
+		t.Errorf("unexpected counts: %+v", last)
+	}
+	if last.Done != 100 || last.Total != 120 {
+		t.Errorf("Done, Total = %v, %v, want 100, 120", last.Done, last.Total)
+	}
+	if last.Rate != 10 {
+		t.Errorf("Rate = %v, want 10", last.Rate)
+	}
+	if last.ETA.Seconds() != 2 {
+		t.Errorf("ETA = %v, want 2s", last.ETA)
+	}
+
+	pa.Track(Progress{Event: ProgressStarted, BucketName: "b", ObjPathName: "d.txt", Total: -1})
+	if got := pa.Snapshot(); got.Total != -1 || got.ETA != -1 {
+		t.Errorf("unknown total should make Total and ETA -1, got %+v", got)
+	}
+}
+
+func TestProgressAggregator_transfers(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	content := bytes.Repeat([]byte("0123456789"), 1200*1024) // 12000Kb，上传3个、下载2个数据块
+	size := int64(len(content))
+	dir := t.TempDir()
+	file := filepath.Join(dir, "up.bin")
+	ioutil.WriteFile(file, content, 0644)
+
+	pa := InitProgressAggregator(nil)
+	var events []Progress
+	client := server.client().WithProgress(func(p Progress) {
+		events = append(events, p)
+		pa.Track(p)
+	})
+
+	check := func(name string, upload bool, chunks int) {
+		if len(events) != chunks+2 {
+			t.Fatalf("%s events = %d, want %d", name, len(events), chunks+2)
+		}
+		var done int64
+		for i, p := range events {
+			want := ProgressChunkDone
+			switch i {
+			case 0:
+				want = ProgressStarted
+			case len(events) - 1:
+				want = ProgressCompleted
+			}
+			if p.Event != want || p.Upload != upload || p.Done < done {
+				t.Errorf("%s event %d = %+v", name, i, p)
+			}
+			done = p.Done
+		}
+		if last := events[len(events)-1]; last.Done != size || last.Total != size {
+			t.Errorf("%s completed = %+v", name, last)
+		}
+		events = nil
+	}
+
+	if r, err := client.UploadObject("b", "x.bin", file, 0); err != nil || !r.Ok {
+		t.Fatalf("UploadObject() = %+v, %v", r, err)
+	}
+	check("upload", true, 3)
+	if r, err := client.DownLoadObject("b", "x.bin", dir, "down.bin", 0); err != nil || !r.Ok {
+		t.Fatalf("DownLoadObject() = %+v, %v", r, err)
+	}
+	check("download", false, 2)
+
+	// 结束的传输只计入汇总
+	got := pa.Snapshot()
+	if got.Transfers != 2 || got.Completed != 2 || got.Active != 0 || got.Done != 2*size || got.Total != 2*size {
+		t.Errorf("Snapshot() = %+v", got)
+	}
+	if len(pa.transfers) != 0 {
+		t.Errorf("finished transfers should be removed, got %d", len(pa.transfers))
+	}
+}
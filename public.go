@@ -0,0 +1,442 @@
+package goharbor
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"goharbor/grequests"
+)
+
+// publicChunkSize 匿名下载时每个Range请求的默认大小
+const publicChunkSize = 1024 * 1024 * 10 //10Mb
+
+// PublicClient 匿名访问公开分享对象的client，不需要访问密钥
+// 使用ConfigStruct中的传输配置、带宽限制、中间件、日志、指标和进度回调
+type PublicClient struct {
+	configs ConfigStruct
+}
+
+// InitPublicClient 初始化一个匿名client，配置同InitConfig，但不需要ACCESSKEY和SECRETKEY
+func InitPublicClient(c map[ConfigKeyType]string) (PublicClient, error) {
+	configs, err := parseConfig(c)
+	if err != nil {
+		return PublicClient{}, err
+	}
+	return PublicClient{configs: configs}, nil
+}
+
+// GetConfigs 获取配置信息
+func (pc PublicClient) GetConfigs() ConfigStruct {
+	return pc.configs
+}
+
+// WithProgress 返回一个使用指定进度回调的client副本
+// param fn: 传输进度回调函数，nil为不回调
+func (pc PublicClient) WithProgress(fn ProgressFunc) PublicClient {
+	pc.configs.Progress = fn
+	return pc
+}
+
+// ObjectURL 公开分享对象的下载url，不需要访问密钥
+// param bucketName: 桶名称
+// param objPathName: 桶下全路径对象名称
+func (pc PublicClient) ObjectURL(bucketName, objPathName string) string {
+	builder := apiBuilderStruct{configs: pc.configs}
+	u := builder.buildURL(buildPath([]string{"share", "obs", bucketName, objPathName}), nil)
+	return u.String()
+}
+
+// MetadataURL 服务器返回的元数据中的公开下载url（download_url）
+// param obj: 对象元数据，如ClientStruct.GetMetadata返回的Obj
+func (pc PublicClient) MetadataURL(obj MetadataStruct) (string, error) {
+	if obj.IsDir() {
+		return "", errors.New("目录没有下载url")
+	}
+	if obj.DownloadURL == "" {
+		return "", errors.New("元数据中没有download_url，对象可能未公开分享")
+	}
+	return obj.DownloadURL, nil
+}
+
+// do 发送一个匿名请求
+func (pc PublicClient) do(method, url string, headers map[string]string) (*grequests.Response, error) {
+	ro := &grequests.RequestOptions{
+		Headers:    headers,
+		HTTPClient: pc.configs.HTTPClient,
+	}
+	start := time.Now()
+	h := chainMiddlewares(pc.configs.Middlewares, sendRequest)
+	resp, err := h(&APIRequest{Method: method, URL: url, Options: ro})
+
+	latency := time.Since(start)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	logRequest(pc.configs.Logger, method, url, resp, err, 1, latency)
+	observeRequest(pc.configs, method, url, status, 1, latency)
+	return resp, err
+}
+
+// parseContentRange 解析Content-Range，如 "bytes 0-99/1000"、"bytes */1000"
+func parseContentRange(s string) (start, end, total int64, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "bytes ") {
+		return 0, 0, 0, errors.New("invalid Content-Range: " + s)
+	}
+	s = strings.TrimPrefix(s, "bytes ")
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return 0, 0, 0, errors.New("invalid Content-Range: " + s)
+	}
+	total, err = strconv.ParseInt(s[i+1:], 10, 64)
+	if err != nil {
+		return 0, 0, 0, errors.New("invalid Content-Range: " + s)
+	}
+	if s[:i] == "*" {
+		return 0, -1, total, nil
+	}
+	parts := strings.SplitN(s[:i], "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, 0, errors.New("invalid Content-Range: " + s)
+	}
+	start, err1 := strconv.ParseInt(parts[0], 10, 64)
+	end, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil || start > end {
+		return 0, 0, 0, errors.New("invalid Content-Range: " + s)
+	}
+	return start, end, total, nil
+}
+
+// responseValidator 用于If-Range的对象版本标识，优先使用强ETag
+func responseValidator(resp *grequests.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// DownloadRange 通过HTTP Range请求下载公开对象的一个数据块
+// param objURL: 对象的公开下载url，如MetadataStruct.DownloadURL
+// param offset: 数据块在对象中的字节偏移量
+// param size: 要下载的数据块大小
+func (pc PublicClient) DownloadRange(objURL string, offset int64, size int) (*ChunkReturn, error) {
+	cr, _, err := pc.downloadRange(objURL, offset, size, "", nil)
+	return cr, err
+}
+
+// downloadRange 下载一个数据块，返回对象的版本标识
+// ifRange不为空时，对象已被修改则服务器返回200，视为失败
+// 服务器不支持Range时，offset为0且ifRange为空则返回对象的数据，Code为200：
+// w为nil时最多读取size字节，对象大小未知时ObjSize为-1；否则整个对象写入w
+// param w: 不为nil时数据直接写入w的offset处，不保存在Chunk中
+func (pc PublicClient) downloadRange(objURL string, offset int64, size int, ifRange string, w io.WriterAt) (*ChunkReturn, string, error) {
+	if offset < 0 || size <= 0 {
+		return nil, "", errors.New("offset must be >= 0 and size must be > 0")
+	}
+	headers := map[string]string{
+		"Range":           fmt.Sprintf("bytes=%d-%d", offset, offset+int64(size)-1),
+		"Accept-Encoding": "identity",
+	}
+	if ifRange != "" {
+		headers["If-Range"] = ifRange
+	}
+	resp, err := pc.do("GET", objURL, headers)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Close()
+	validator := responseValidator(resp)
+
+	cr := &ChunkReturn{}
+	cr.ChunkOffset = offset
+	cr.Code = resp.StatusCode
+	switch resp.StatusCode {
+	case 206:
+		start, end, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, validator, err
+		}
+		if start != offset {
+			return nil, validator, errors.New("服务器返回的数据块偏移量与请求的不一致")
+		}
+		cr.ObjSize = total
+		cr.ChunkSize = end - start + 1
+	case 200:
+		if offset != 0 || ifRange != "" {
+			cr.CodeText = "对象在下载期间被修改，或服务器不支持Range请求"
+			return cr, validator, nil
+		}
+		cr.ObjSize = resp.RawResponse.ContentLength
+	case 416:
+		// offset超出对象大小，空对象也返回416
+		if _, _, total, err := parseContentRange(resp.Header.Get("Content-Range")); err == nil {
+			cr.ObjSize = total
+		}
+		cr.CodeText = "offset超出了对象大小"
+		return cr, validator, nil
+	default:
+		result := ResponseResult(resp)
+		result.Ok = false
+		if result.CodeText == "" {
+			result.CodeText = "Failed to download an chunk of object"
+		}
+		cr.Results = *result
+		return cr, validator, nil
+	}
+
+	var body io.Reader = limitReader(resp.RawResponse.Body, pc.configs.RateLimiter)
+	var n int64
+	if w != nil {
+		// 服务器忽略Range时返回整个对象，不读入内存
+		n, err = io.Copy(io.NewOffsetWriter(w, offset), body)
+	} else {
+		if resp.StatusCode == 200 {
+			body = io.LimitReader(body, int64(size))
+		}
+		cr.Chunk, err = ioutil.ReadAll(body)
+		n = int64(len(cr.Chunk))
+	}
+	if m := pc.configs.Metrics; m != nil {
+		m.AddBytes(false, n)
+	}
+	if err != nil {
+		return nil, validator, err
+	}
+	if resp.StatusCode == 200 {
+		if cr.ObjSize < 0 && (w != nil || n < int64(size)) {
+			// 已读到对象末尾
+			cr.ObjSize = n
+		}
+		cr.ChunkSize = cr.ObjSize
+		if w == nil && (cr.ObjSize < 0 || cr.ObjSize > int64(size)) {
+			cr.ChunkSize = int64(size)
+		}
+	}
+	if n != cr.ChunkSize {
+		cr.CodeText = "应返回的数据长度和实际下载的数据长度不一致"
+		return cr, validator, nil
+	}
+	cr.Ok = true
+	cr.CodeText = "Download successfull"
+	return cr, validator, nil
+}
+
+// PublicDownloadOptions 匿名下载选项
+type PublicDownloadOptions struct {
+	Offset    int64  // 从此偏移量处续传；<0时根据本地文件大小自动续传，0时重新下载；续传需要本地的对象版本记录，没有时从0重新下载
+	ChunkSize int    // 每个Range请求的大小，<=0时为10Mb
+	SHA256    string // 期望的sha256(hex)，不为空时下载完成后校验整个文件
+	MD5       string // 期望的md5(hex)，不为空时下载完成后校验整个文件
+}
+
+// DownloadObject 匿名下载一个公开分享的对象到本地文件，支持断点续传和完整性校验
+// param bucketName: 桶名称
+// param objPathName: 桶下全路径对象名称
+// param filePathName: 本地文件全路径
+// param opts: 下载选项
+func (pc PublicClient) DownloadObject(bucketName, objPathName, filePathName string, opts PublicDownloadOptions) (*ObjReturn, error) {
+	return pc.download(pc.ObjectURL(bucketName, objPathName), objPathName, filePathName, opts)
+}
+
+// DownloadMetadata 通过元数据中的download_url匿名下载一个对象到本地文件，支持断点续传和完整性校验
+// param obj: 对象元数据，如ClientStruct.GetMetadata返回的Obj
+// param filePathName: 本地文件全路径
+// param opts: 下载选项
+func (pc PublicClient) DownloadMetadata(obj MetadataStruct, filePathName string, opts PublicDownloadOptions) (*ObjReturn, error) {
+	objURL, err := pc.MetadataURL(obj)
+	if err != nil {
+		return nil, err
+	}
+	return pc.download(objURL, obj.PathName, filePathName, opts)
+}
+
+// DownloadURL 通过公开下载url匿名下载一个对象到本地文件，支持断点续传和完整性校验
+// param objURL: 对象的公开下载url，如ObjectURL、MetadataStruct.DownloadURL、ShareReturn.ShareURL
+// param filePathName: 本地文件全路径
+// param opts: 下载选项
+func (pc PublicClient) DownloadURL(objURL, filePathName string, opts PublicDownloadOptions) (*ObjReturn, error) {
+	if _, err := url.Parse(objURL); err != nil {
+		return nil, err
+	}
+	return pc.download(objURL, objURL, filePathName, opts)
+}
+
+// publicValidatorSuffix 下载中的本地文件旁记录对象版本标识（ETag或Last-Modified）的文件后缀，用于续传时的If-Range
+const publicValidatorSuffix = ".harbor-range"
+
+// readValidator 读取本地文件旁记录的对象版本标识，没有记录时返回""
+func readValidator(filePathName string) string {
+	data, err := ioutil.ReadFile(filePathName + publicValidatorSuffix)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// writeValidator 记录对象版本标识，validator为空时删除记录
+func writeValidator(filePathName, validator string) error {
+	if validator == "" {
+		return removeValidator(filePathName)
+	}
+	return ioutil.WriteFile(filePathName+publicValidatorSuffix, []byte(validator), 0644)
+}
+
+// removeValidator 删除对象版本标识记录
+func removeValidator(filePathName string) error {
+	if err := os.Remove(filePathName + publicValidatorSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// download 分块下载对象到本地文件
+// 续传时第一个请求携带本地记录的对象版本标识作为If-Range，没有记录或对象已被修改时从0重新下载
+func (pc PublicClient) download(objURL, objPathName, filePathName string, opts PublicDownloadOptions) (*ObjReturn, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = publicChunkSize
+	}
+
+	file, err := os.OpenFile(filePathName, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	offset := opts.Offset
+	if offset < 0 {
+		fi, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		offset = fi.Size()
+	}
+
+	// 续传的数据必须和本地已有的数据属于同一个对象版本
+	var validator string
+	resumed := offset > 0
+	if resumed {
+		validator = readValidator(filePathName)
+		if validator == "" {
+			offset = 0
+			resumed = false
+		}
+	}
+	restart := func() {
+		offset = 0
+		validator = ""
+		resumed = false
+	}
+
+	ret := &ObjReturn{ObjSize: -1}
+	var retErr error
+	pt := newProgressTracker(pc.configs, false, "", objPathName, offset, -1)
+	pt.start()
+	for {
+		r, v, err := pc.downloadRange(objURL, offset, chunkSize, validator, file)
+		if err != nil {
+			retErr = err
+			break
+		}
+		if r.Code == 416 && r.ObjSize == offset {
+			// 416不受If-Range影响，续传时版本标识不一致说明对象已被修改
+			if resumed && v != "" && v != validator {
+				restart()
+				continue
+			}
+			// 本地文件已完整，或空对象
+			ret.ObjSize = offset
+			pt.setTotal(ret.ObjSize)
+			ret.Ok = true
+			break
+		}
+		if resumed && r.Code == 200 {
+			// If-Range不匹配，对象已被修改
+			restart()
+			continue
+		}
+		if !r.Ok {
+			ret.Results = r.Results
+			break
+		}
+		resumed = false
+		if validator == "" {
+			validator = v
+			if err := writeValidator(filePathName, validator); err != nil {
+				retErr = err
+				break
+			}
+		}
+		if ret.ObjSize >= 0 && r.ObjSize != ret.ObjSize {
+			retErr = errors.New("对象在下载期间大小发生了变化")
+			break
+		}
+		ret.ObjSize = r.ObjSize
+		pt.setTotal(ret.ObjSize)
+
+		pt.chunkDone(r.ChunkOffset, r.ChunkSize)
+		offset = r.ChunkOffset + r.ChunkSize
+		if offset >= ret.ObjSize {
+			ret.Ok = true
+			break
+		}
+	}
+	ret.Offset = offset
+
+	if ret.Ok {
+		retErr = file.Truncate(ret.ObjSize)
+		if retErr == nil {
+			retErr = verifyFileDigest(filePathName, opts.SHA256, opts.MD5)
+		}
+		if retErr == nil {
+			retErr = removeValidator(filePathName)
+		}
+		if retErr != nil {
+			ret.Ok = false
+		} else {
+			ret.Code = 200
+			ret.CodeText = "download ok"
+		}
+	}
+	pt.finish(ret.Ok, progressErr(ret, retErr))
+	return ret, retErr
+}
+
+// verifyFileDigest 校验文件的sha256和md5，期望值为空时不校验
+func verifyFileDigest(filePathName, sha256Hex, md5Hex string) error {
+	if sha256Hex == "" && md5Hex == "" {
+		return nil
+	}
+	f, err := os.Open(filePathName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hs, hm := sha256.New(), md5.New()
+	if _, err := io.Copy(io.MultiWriter(hs, hm), f); err != nil {
+		return err
+	}
+	check := func(name, want string, h hash.Hash) error {
+		if want != "" && !strings.EqualFold(want, hex.EncodeToString(h.Sum(nil))) {
+			return errors.New(name + "校验失败，下载的文件已损坏或对象已被修改")
+		}
+		return nil
+	}
+	if err := check("sha256", sha256Hex, hs); err != nil {
+		return err
+	}
+	return check("md5", md5Hex, hm)
+}
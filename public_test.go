@@ -0,0 +1,197 @@
+package goharbor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goharbor/grequests"
+)
+
+func Test_PublicClientDownload(t *testing.T) {
+	var mu sync.Mutex
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	version := "v1"
+	requests := 0
+	var ranges, ifRanges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Error("anonymous request carries Authorization")
+		}
+		mu.Lock()
+		data, etag := content, version
+		requests++
+		ranges = append(ranges, r.Header.Get("Range"))
+		ifRanges = append(ifRanges, r.Header.Get("If-Range"))
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/dl/x.bin", "/share/obs/b/a/x.bin":
+		case "/norange/x.bin":
+			// 忽略Range，返回整个对象
+			w.Write(data)
+			return
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"`+etag+`"`)
+		http.ServeContent(w, r, "x.bin", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	pc, err := InitPublicClient(map[ConfigKeyType]string{
+		SCHEME: HTTP,
+		HOST:   strings.TrimPrefix(server.URL, "http://"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	dir := t.TempDir()
+	obj := MetadataStruct{PathName: "a/x.bin", FileOrDir: true, DownloadURL: server.URL + "/dl/x.bin"}
+	reset := func() {
+		mu.Lock()
+		requests, ranges, ifRanges = 0, nil, nil
+		mu.Unlock()
+	}
+
+	// 下载url来自元数据
+	if _, err := pc.MetadataURL(MetadataStruct{PathName: "a/y.bin", FileOrDir: true}); err == nil {
+		t.Error("expected error for metadata without download_url")
+	}
+	if _, err := pc.MetadataURL(MetadataStruct{PathName: "a", DownloadURL: obj.DownloadURL}); err == nil {
+		t.Error("expected error for directory")
+	}
+
+	// 分块下载并校验
+	file := filepath.Join(dir, "x.bin")
+	r, err := pc.DownloadMetadata(obj, file, PublicDownloadOptions{ChunkSize: 3000, SHA256: hex.EncodeToString(sum[:])})
+	if err != nil || !r.Ok || r.ObjSize != int64(len(content)) || requests != 4 {
+		t.Fatalf("DownloadMetadata() = %+v, %v, requests %d", r, err, requests)
+	}
+	if got, _ := ioutil.ReadFile(file); !bytes.Equal(got, content) {
+		t.Error("downloaded content mismatch")
+	}
+	if _, err := os.Stat(file + publicValidatorSuffix); !os.IsNotExist(err) {
+		t.Errorf("validator record not removed: %v", err)
+	}
+
+	// 根据本地文件大小和记录的对象版本续传
+	part := filepath.Join(dir, "part.bin")
+	ioutil.WriteFile(part, content[:7000], 0644)
+	ioutil.WriteFile(part+publicValidatorSuffix, []byte(`"v1"`), 0644)
+	reset()
+	r, err = pc.DownloadURL(obj.DownloadURL, part, PublicDownloadOptions{Offset: -1, ChunkSize: 5000})
+	if err != nil || !r.Ok || requests != 1 || ifRanges[0] != `"v1"` || ranges[0] != "bytes=7000-11999" {
+		t.Fatalf("resume DownloadURL() = %+v, %v, requests %d %v %v", r, err, requests, ranges, ifRanges)
+	}
+	if got, _ := ioutil.ReadFile(part); !bytes.Equal(got, content) {
+		t.Error("resumed content mismatch")
+	}
+
+	// 没有版本记录时不能确认本地数据属于同一对象，从0重新下载
+	stale := filepath.Join(dir, "stale.bin")
+	ioutil.WriteFile(stale, bytes.Repeat([]byte("x"), 7000), 0644)
+	reset()
+	r, err = pc.DownloadMetadata(obj, stale, PublicDownloadOptions{Offset: -1, ChunkSize: 6000})
+	if err != nil || !r.Ok || ranges[0] != "bytes=0-5999" || ifRanges[0] != "" {
+		t.Fatalf("DownloadMetadata() without validator = %+v, %v, %v %v", r, err, ranges, ifRanges)
+	}
+	if got, _ := ioutil.ReadFile(stale); !bytes.Equal(got, content) {
+		t.Error("restarted content mismatch")
+	}
+
+	// 记录的版本与对象不一致，服务器返回整个对象后从0重新下载
+	ioutil.WriteFile(stale, bytes.Repeat([]byte("x"), 7000), 0644)
+	ioutil.WriteFile(stale+publicValidatorSuffix, []byte(`"v0"`), 0644)
+	reset()
+	r, err = pc.DownloadMetadata(obj, stale, PublicDownloadOptions{Offset: -1, ChunkSize: 6000})
+	if err != nil || !r.Ok || ifRanges[0] != `"v0"` || ranges[1] != "bytes=0-5999" {
+		t.Fatalf("DownloadMetadata() with stale validator = %+v, %v, %v %v", r, err, ranges, ifRanges)
+	}
+	if got, _ := ioutil.ReadFile(stale); !bytes.Equal(got, content) {
+		t.Error("restarted content mismatch")
+	}
+
+	// 校验失败
+	r, err = pc.DownloadMetadata(obj, file, PublicDownloadOptions{MD5: "00"})
+	if err == nil || r.Ok {
+		t.Errorf("expected digest error, got %+v, %v", r, err)
+	}
+
+	// 下载期间对象被修改，保留版本记录
+	changed := filepath.Join(dir, "changed.bin")
+	pc2 := PublicClient{configs: pc.configs}
+	pc2.configs.Middlewares = []Middleware{func(next Handler) Handler {
+		return func(req *APIRequest) (*grequests.Response, error) {
+			resp, err := next(req)
+			mu.Lock()
+			version = "v2"
+			mu.Unlock()
+			return resp, err
+		}
+	}}
+	r, err = pc2.DownloadMetadata(obj, changed, PublicDownloadOptions{ChunkSize: 3000})
+	if err != nil || r.Ok || r.Offset != 3000 {
+		t.Errorf("expected changed object failure, got %+v, %v", r, err)
+	}
+	if v := readValidator(changed); v != `"v1"` {
+		t.Errorf("validator record = %q", v)
+	}
+
+	// 不需要访问密钥，通过桶和路径下载
+	if u := pc.ObjectURL("b", "a/x.bin"); u != server.URL+"/share/obs/b/a/x.bin" {
+		t.Errorf("ObjectURL() = %s", u)
+	}
+	byPath := filepath.Join(dir, "path.bin")
+	r, err = pc.DownloadObject("b", "a/x.bin", byPath, PublicDownloadOptions{ChunkSize: 6000})
+	if err != nil || !r.Ok || r.ObjSize != int64(len(content)) {
+		t.Fatalf("DownloadObject() = %+v, %v", r, err)
+	}
+	if got, _ := ioutil.ReadFile(byPath); !bytes.Equal(got, content) {
+		t.Error("downloaded content mismatch")
+	}
+
+	// 服务器不支持Range时整个对象直接写入文件，DownloadRange只返回请求的大小，
+	// 服务器未返回Content-Length时对象大小未知
+	whole := filepath.Join(dir, "whole.bin")
+	r, err = pc.DownloadURL(server.URL+"/norange/x.bin", whole, PublicDownloadOptions{ChunkSize: 3000})
+	if err != nil || !r.Ok || r.ObjSize != int64(len(content)) {
+		t.Fatalf("DownloadURL() without Range support = %+v, %v", r, err)
+	}
+	if got, _ := ioutil.ReadFile(whole); !bytes.Equal(got, content) {
+		t.Error("downloaded content mismatch")
+	}
+	cr, err := pc.DownloadRange(server.URL+"/norange/x.bin", 0, 3000)
+	if err != nil || !cr.Ok || cr.Code != 200 || cr.ObjSize != -1 || !bytes.Equal(cr.Chunk, content[:3000]) {
+		t.Errorf("DownloadRange() without Range support = %+v, %v", cr.Results, err)
+	}
+
+	// 对象不存在
+	r, err = pc.DownloadURL(server.URL+"/dl/nothing", filepath.Join(dir, "n"), PublicDownloadOptions{})
+	if err != nil || r.Ok || r.Code != 404 {
+		t.Errorf("missing object = %+v, %v", r, err)
+	}
+}
+
+func Test_parseContentRange(t *testing.T) {
+	start, end, total, err := parseContentRange("bytes 10-19/100")
+	if err != nil || start != 10 || end != 19 || total != 100 {
+		t.Errorf("parseContentRange() = %d %d %d %v", start, end, total, err)
+	}
+	if _, _, total, err := parseContentRange("bytes */0"); err != nil || total != 0 {
+		t.Errorf("parseContentRange(*/0) = %d %v", total, err)
+	}
+	if _, _, _, err := parseContentRange("items 1-2/3"); err == nil {
+		t.Error("expected error")
+	}
+}
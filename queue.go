@@ -0,0 +1,520 @@
+package goharbor
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TransferKind 传输类型
+type TransferKind uint8
+
+const (
+	// TransferUpload 上传本地文件到对象
+	TransferUpload TransferKind = iota
+	// TransferDownload 下载对象到本地文件
+	TransferDownload
+)
+
+// TaskStatus 传输任务状态
+type TaskStatus string
+
+const (
+	// TaskPending 等待执行或等待重试
+	TaskPending TaskStatus = "pending"
+	// TaskRunning 执行中
+	TaskRunning TaskStatus = "running"
+	// TaskDone 已完成
+	TaskDone TaskStatus = "done"
+	// TaskFailed 重试次数用尽或不可重试的错误
+	TaskFailed TaskStatus = "failed"
+)
+
+// TransferTask 一个持久化的传输任务
+type TransferTask struct {
+	ID           string       `json:"id"`
+	Kind         TransferKind `json:"kind"`
+	BucketName   string       `json:"bucket_name"`
+	ObjPathName  string       `json:"obj_path_name"`
+	LocalPath    string       `json:"local_path"` // 上传的本地文件，或下载保存的本地文件
+	Priority     int          `json:"priority"`   // 优先级，大的优先执行
+	Status       TaskStatus   `json:"status"`
+	Offset       int64        `json:"offset"`         // 已完成的字节偏移量，用于断点续传
+	Size         int64        `json:"size"`           // 对象大小，未知时为-1
+	LocalSize    int64        `json:"local_size"`     // 保存Offset时本地文件的大小，不存在时为-1
+	LocalModTime time.Time    `json:"local_mod_time"` // 保存Offset时本地文件的修改时间，续传前与本地文件不一致时从头开始
+	Attempts     int          `json:"attempts"`
+	LastError    string       `json:"last_error,omitempty"`
+	Created      time.Time    `json:"created"`
+	Updated      time.Time    `json:"updated"`
+	NextAttempt  time.Time    `json:"next_attempt"`
+}
+
+// QueueEvent 传输队列事件
+type QueueEvent struct {
+	Task     TransferTask // 事件发生时任务的快照
+	Progress *Progress    // 数据块完成时的传输进度，任务状态变化时为nil
+}
+
+// QueueOptions 传输队列选项
+type QueueOptions struct {
+	Dir        string           // 任务持久化目录，不能为空
+	Workers    int              // 并发执行的任务数，<=0时为2
+	MaxRetries int              // 失败后的最大重试次数，0时为5，<0时不限制
+	RetryDelay time.Duration    // 第一次重试的等待时间，之后指数增长，最长10分钟；<=0时为5s
+	OnEvent    func(QueueEvent) // 任务状态变化和传输进度的回调，可以为nil，不应长时间阻塞
+}
+
+// maxRetryDelay 重试等待时间的上限
+const maxRetryDelay = 10 * time.Minute
+
+var errUnknownTransfer = errors.New("unknown transfer kind")
+
+// TransferQueue 持久化的上传下载队列，进程重启后继续执行未完成的任务
+// 任务以json文件保存在队列目录中，每完成一个数据块保存一次偏移量，重启后断点续传
+type TransferQueue struct {
+	mu      sync.Mutex
+	client  ClientStruct
+	opts    QueueOptions
+	tasks   map[string]*TransferTask
+	wake    chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	started bool
+}
+
+// InitTransferQueue 初始化一个传输队列，并加载队列目录中已有的任务
+// 上次退出时执行中的任务恢复为等待执行
+func InitTransferQueue(client ClientStruct, opts QueueOptions) (*TransferQueue, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("QueueOptions.Dir can not be empty")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 2
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 5
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 5 * time.Second
+	}
+	if err := os.MkdirAll(opts.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	q := &TransferQueue{
+		client: client,
+		opts:   opts,
+		tasks:  make(map[string]*TransferTask),
+		wake:   make(chan struct{}, 1),
+	}
+	names, err := filepath.Glob(filepath.Join(opts.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		t := &TransferTask{}
+		if err := json.Unmarshal(data, t); err != nil || t.ID == "" {
+			// 写入中断的任务文件
+			os.Remove(name)
+			continue
+		}
+		if t.Status == TaskRunning {
+			t.Status = TaskPending
+		}
+		q.tasks[t.ID] = t
+	}
+	return q, nil
+}
+
+func (q *TransferQueue) taskPath(id string) string {
+	return filepath.Join(q.opts.Dir, id+".json")
+}
+
+// save 持久化任务，先写临时文件再重命名，调用者需持有锁
+func (q *TransferQueue) save(t *TransferTask) error {
+	t.Updated = time.Now()
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	tmp := q.taskPath(t.ID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.taskPath(t.ID))
+}
+
+// emit 回调任务事件，调用者不能持有锁
+func (q *TransferQueue) emit(t TransferTask, p *Progress) {
+	if q.opts.OnEvent != nil {
+		q.opts.OnEvent(QueueEvent{Task: t, Progress: p})
+	}
+}
+
+// notify 唤醒等待任务的worker
+func (q *TransferQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// EnqueueUpload 添加一个上传任务，返回任务id
+// param bucketName: 桶名称
+// param objPathName: 桶下全路径对象名称
+// param fileName: 上传的本地文件
+// param priority: 优先级，大的优先执行
+func (q *TransferQueue) EnqueueUpload(bucketName, objPathName, fileName string, priority int) (string, error) {
+	return q.enqueue(TransferUpload, bucketName, objPathName, fileName, priority)
+}
+
+// EnqueueDownload 添加一个下载任务，返回任务id
+// param bucketName: 桶名称
+// param objPathName: 桶下全路径对象名称
+// param fileName: 下载保存的本地文件
+// param priority: 优先级，大的优先执行
+func (q *TransferQueue) EnqueueDownload(bucketName, objPathName, fileName string, priority int) (string, error) {
+	return q.enqueue(TransferDownload, bucketName, objPathName, fileName, priority)
+}
+
+func (q *TransferQueue) enqueue(kind TransferKind, bucketName, objPathName, fileName string, priority int) (string, error) {
+	if bucketName == "" || objPathName == "" || fileName == "" {
+		return "", errors.New("bucketName, objPathName and fileName can not be empty")
+	}
+	now := time.Now()
+	t := &TransferTask{
+		ID:          now.UTC().Format("20060102150405") + "-" + randomHex(6),
+		Kind:        kind,
+		BucketName:  bucketName,
+		ObjPathName: objPathName,
+		LocalPath:   fileName,
+		Priority:    priority,
+		Status:      TaskPending,
+		Size:        -1,
+		Created:     now,
+		NextAttempt: now,
+	}
+
+	q.mu.Lock()
+	if err := q.save(t); err != nil {
+		q.mu.Unlock()
+		return "", err
+	}
+	q.tasks[t.ID] = t
+	snapshot := *t
+	q.mu.Unlock()
+
+	q.emit(snapshot, nil)
+	q.notify()
+	return t.ID, nil
+}
+
+// Get 查询一个任务
+func (q *TransferQueue) Get(id string) (TransferTask, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tasks[id]
+	if !ok {
+		return TransferTask{}, false
+	}
+	return *t, true
+}
+
+// List 查询全部任务，按优先级和创建时间排序
+// param status: 只返回这些状态的任务，为空时返回全部任务
+func (q *TransferQueue) List(status ...TaskStatus) []TransferTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ret := make([]TransferTask, 0, len(q.tasks))
+	for _, t := range q.tasks {
+		if len(status) > 0 && !containsStatus(status, t.Status) {
+			continue
+		}
+		ret = append(ret, *t)
+	}
+	sort.Slice(ret, func(i, j int) bool { return taskLess(&ret[i], &ret[j]) })
+	return ret
+}
+
+func containsStatus(s []TaskStatus, status TaskStatus) bool {
+	for _, v := range s {
+		if v == status {
+			return true
+		}
+	}
+	return false
+}
+
+// taskLess 优先级高的在前，同优先级先创建的在前
+func taskLess(a, b *TransferTask) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if !a.Created.Equal(b.Created) {
+		return a.Created.Before(b.Created)
+	}
+	return a.ID < b.ID
+}
+
+// Retry 重新执行一个失败的任务
+func (q *TransferQueue) Retry(id string) error {
+	q.mu.Lock()
+	t, ok := q.tasks[id]
+	if !ok {
+		q.mu.Unlock()
+		return errors.New("task not found: " + id)
+	}
+	if t.Status != TaskFailed {
+		q.mu.Unlock()
+		return errors.New("only failed task can be retried")
+	}
+	t.Status = TaskPending
+	t.Attempts = 0
+	t.NextAttempt = time.Now()
+	err := q.save(t)
+	snapshot := *t
+	q.mu.Unlock()
+
+	q.emit(snapshot, nil)
+	q.notify()
+	return err
+}
+
+// Remove 删除一个未在执行中的任务
+func (q *TransferQueue) Remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tasks[id]
+	if !ok {
+		return errors.New("task not found: " + id)
+	}
+	if t.Status == TaskRunning {
+		return errors.New("can not remove a running task")
+	}
+	delete(q.tasks, id)
+	err := os.Remove(q.taskPath(id))
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return err
+}
+
+// Start 启动后台worker执行任务
+func (q *TransferQueue) Start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.started {
+		return
+	}
+	q.started = true
+	q.stop = make(chan struct{})
+	for i := 0; i < q.opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker(q.stop)
+	}
+}
+
+// Stop 停止后台worker，等待执行中的任务结束当前传输
+func (q *TransferQueue) Stop() {
+	q.mu.Lock()
+	if !q.started {
+		q.mu.Unlock()
+		return
+	}
+	q.started = false
+	close(q.stop)
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// next 取出一个可执行的任务并标记为执行中；没有可执行的任务时返回最早的重试时间
+func (q *TransferQueue) next(now time.Time) (*TransferTask, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var best *TransferTask
+	var wakeAt time.Time
+	for _, t := range q.tasks {
+		if t.Status != TaskPending {
+			continue
+		}
+		if t.NextAttempt.After(now) {
+			if wakeAt.IsZero() || t.NextAttempt.Before(wakeAt) {
+				wakeAt = t.NextAttempt
+			}
+			continue
+		}
+		if best == nil || taskLess(t, best) {
+			best = t
+		}
+	}
+	if best != nil {
+		best.Status = TaskRunning
+		best.Attempts++
+		q.save(best)
+	}
+	return best, wakeAt
+}
+
+func (q *TransferQueue) worker(stop chan struct{}) {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		t, wakeAt := q.next(time.Now())
+		if t != nil {
+			// 可能还有其他可执行的任务，唤醒一个空闲的worker
+			q.notify()
+			q.run(t)
+			continue
+		}
+
+		wait := time.Minute
+		if !wakeAt.IsZero() {
+			wait = time.Until(wakeAt)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// localState 本地文件的大小和修改时间，文件不存在时大小为-1
+func localState(name string) (int64, time.Time) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return -1, time.Time{}
+	}
+	return fi.Size(), fi.ModTime()
+}
+
+// recordLocal 记录本地文件的当前状态，上传记录开始上传时的文件，下载记录每次保存偏移量时的文件
+func (t *TransferTask) recordLocal() {
+	t.LocalSize, t.LocalModTime = localState(t.LocalPath)
+}
+
+// run 执行一个任务，每完成一个数据块保存一次偏移量
+func (q *TransferQueue) run(t *TransferTask) {
+	client := q.client
+
+	q.mu.Lock()
+	// 压缩传输不能续传；上次保存偏移量之后本地文件被修改时已传输的数据不再有效，都从头开始
+	if t.Offset > 0 {
+		size, modTime := localState(t.LocalPath)
+		if client.API.configs.Compression != nil || size != t.LocalSize || !modTime.Equal(t.LocalModTime) {
+			t.Offset = 0
+		}
+	}
+	if t.Offset == 0 && t.Kind == TransferUpload {
+		t.recordLocal()
+	}
+	offset := t.Offset
+	q.save(t)
+	snapshot := *t
+	q.mu.Unlock()
+	q.emit(snapshot, nil)
+
+	userProgress := client.API.configs.Progress
+	client = client.WithProgress(func(p Progress) {
+		if userProgress != nil {
+			userProgress(p)
+		}
+		if p.Event != ProgressChunkDone {
+			return
+		}
+		q.mu.Lock()
+		t.Offset = p.Done
+		t.Size = p.Total
+		if t.Kind == TransferDownload {
+			t.recordLocal()
+		}
+		q.save(t)
+		snapshot := *t
+		q.mu.Unlock()
+		q.emit(snapshot, &p)
+	})
+
+	var ret *ObjReturn
+	var err error
+	switch t.Kind {
+	case TransferUpload:
+		ret, err = client.UploadObject(t.BucketName, t.ObjPathName, t.LocalPath, offset)
+	case TransferDownload:
+		dir, name := filepath.Split(t.LocalPath)
+		if dir == "" {
+			dir = "."
+		}
+		ret, err = client.DownLoadObject(t.BucketName, t.ObjPathName, dir, name, offset)
+	default:
+		err = errUnknownTransfer
+	}
+
+	q.mu.Lock()
+	retryable := true
+	switch {
+	case err == nil && ret.Ok:
+		t.Status = TaskDone
+		t.Offset = ret.Offset
+		t.Size = ret.ObjSize
+		t.LastError = ""
+	default:
+		if err != nil {
+			t.LastError = err.Error()
+			retryable = !os.IsNotExist(err) && err != errUnknownTransfer
+		} else {
+			t.LastError = ret.CodeText
+			retryable = isRetryable(&ret.Results, nil) || ret.Code == 0
+		}
+		if ret != nil && ret.Offset > t.Offset {
+			t.Offset = ret.Offset
+			if t.Kind == TransferDownload {
+				t.recordLocal()
+			}
+		}
+		if !retryable || (q.opts.MaxRetries >= 0 && t.Attempts > q.opts.MaxRetries) {
+			t.Status = TaskFailed
+		} else {
+			t.Status = TaskPending
+			t.NextAttempt = time.Now().Add(retryDelay(q.opts.RetryDelay, t.Attempts))
+		}
+	}
+	q.save(t)
+	snapshot = *t
+	q.mu.Unlock()
+	q.emit(snapshot, nil)
+	if snapshot.Status == TaskPending {
+		q.notify()
+	}
+}
+
+// retryDelay 第attempts次失败后的重试等待时间
+func retryDelay(base time.Duration, attempts int) time.Duration {
+	d := base
+	for i := 1; i < attempts && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
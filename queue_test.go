@@ -0,0 +1,164 @@
+package goharbor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransferQueue(t *testing.T) {
+	var flaky int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "denied"):
+			w.WriteHeader(403)
+		case strings.Contains(r.URL.Path, "flaky") && atomic.AddInt32(&flaky, 1) == 1:
+			w.WriteHeader(503)
+		default:
+			w.WriteHeader(200)
+		}
+	}))
+	defer server.Close()
+
+	client := testClient(server.URL)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "data.txt")
+	ioutil.WriteFile(file, []byte("hello"), 0644)
+	queueDir := filepath.Join(dir, "queue")
+
+	// 未启动的队列中的任务在重启后仍然存在
+	q, err := InitTransferQueue(client, QueueOptions{Dir: queueDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id1, _ := q.EnqueueUpload("b", "a/flaky.txt", file, 0)
+	id2, _ := q.EnqueueUpload("b", "a/denied.txt", file, 10)
+	id3, _ := q.EnqueueUpload("b", "a/ok.txt", file, 5)
+
+	finished := make(chan TransferTask, 10)
+	q, err = InitTransferQueue(client, QueueOptions{
+		Dir:        queueDir,
+		Workers:    1,
+		RetryDelay: 10 * time.Millisecond,
+		OnEvent: func(e QueueEvent) {
+			if e.Progress == nil && (e.Task.Status == TaskDone || e.Task.Status == TaskFailed) {
+				finished <- e.Task
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tasks := q.List(); len(tasks) != 3 || tasks[0].ID != id2 || tasks[1].ID != id3 || tasks[2].ID != id1 {
+		t.Fatalf("List() after restart = %+v", tasks)
+	}
+
+	q.Start()
+	defer q.Stop()
+	var order []string
+	for i := 0; i < 3; i++ {
+		select {
+		case task := <-finished:
+			order = append(order, task.ID)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for tasks")
+		}
+	}
+	// 按优先级执行，失败重试的任务最后完成
+	if strings.Join(order, ",") != strings.Join([]string{id2, id3, id1}, ",") {
+		t.Errorf("finish order = %v", order)
+	}
+
+	task, _ := q.Get(id1)
+	if task.Status != TaskDone || task.Attempts != 2 || task.Offset != 5 {
+		t.Errorf("flaky task = %+v", task)
+	}
+	task, _ = q.Get(id2)
+	if task.Status != TaskFailed || task.Attempts != 1 {
+		t.Errorf("denied task should fail without retry, got %+v", task)
+	}
+	if len(q.List(TaskDone)) != 2 {
+		t.Errorf("List(TaskDone) = %+v", q.List(TaskDone))
+	}
+
+	if err := q.Remove(id3); err != nil {
+		t.Error(err)
+	}
+	if err := q.Retry(id1); err == nil {
+		t.Error("Retry() of a done task should fail")
+	}
+	if err := q.Retry(id2); err != nil {
+		t.Error(err)
+	}
+	select {
+	case task := <-finished:
+		if task.ID != id2 || task.Status != TaskFailed {
+			t.Errorf("retried task = %+v", task)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for retried task")
+	}
+}
+
+func Test_retryDelay(t *testing.T) {
+	if d := retryDelay(time.Second, 1); d != time.Second {
+		t.Errorf("retryDelay(1) = %v", d)
+	}
+	if d := retryDelay(time.Second, 3); d != 4*time.Second {
+		t.Errorf("retryDelay(3) = %v", d)
+	}
+	if d := retryDelay(time.Second, 100); d != maxRetryDelay {
+		t.Errorf("retryDelay(100) = %v", d)
+	}
+}
+
+func TestTransferQueue_localChanged(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "data.txt")
+	ioutil.WriteFile(file, []byte("hello"), 0644)
+
+	finished := make(chan TransferTask, 1)
+	q, err := InitTransferQueue(server.client(), QueueOptions{
+		Dir: filepath.Join(dir, "queue"),
+		OnEvent: func(e QueueEvent) {
+			if e.Progress == nil && (e.Task.Status == TaskDone || e.Task.Status == TaskFailed) {
+				finished <- e.Task
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := q.EnqueueUpload("b", "data.txt", file, 0)
+
+	// 上次上传了3个字节之后本地文件被改写，续传会拼接新旧两个文件的数据
+	q.mu.Lock()
+	task := q.tasks[id]
+	task.Offset = 3
+	task.recordLocal()
+	q.mu.Unlock()
+	ioutil.WriteFile(file, []byte("HELLO, world"), 0644)
+
+	q.Start()
+	defer q.Stop()
+	select {
+	case task := <-finished:
+		if task.Status != TaskDone || task.Offset != 12 {
+			t.Errorf("task = %+v", task)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for task")
+	}
+	if data, _ := server.get("b/data.txt"); string(data) != "HELLO, world" {
+		t.Errorf("uploaded = %q", data)
+	}
+}
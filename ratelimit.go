@@ -0,0 +1,137 @@
+package goharbor
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter 令牌桶带宽限制器，可被多个并发传输共享
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // 每秒产生的令牌数，byte/s
+	burst  int64   // 令牌桶容量，byte
+	tokens float64
+	last   time.Time
+}
+
+// InitRateLimiter 初始化一个带宽限制器
+// param bytesPerSec: 限制的带宽，byte/s
+// param burst: 允许的突发字节数，<=0时等于bytesPerSec
+func InitRateLimiter(bytesPerSec, burst int64) *RateLimiter {
+	rl := &RateLimiter{}
+	rl.SetLimit(bytesPerSec, burst)
+	return rl
+}
+
+// SetLimit 修改带宽限制，bytesPerSec<=0为不限制
+// param bytesPerSec: 限制的带宽，byte/s
+// param burst: 允许的突发字节数，<=0时等于bytesPerSec
+func (rl *RateLimiter) SetLimit(bytesPerSec, burst int64) {
+	if burst <= 0 {
+		burst = bytesPerSec
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.rate = float64(bytesPerSec)
+	rl.burst = burst
+	rl.tokens = float64(burst)
+	rl.last = time.Now()
+}
+
+// Limit 当前的带宽限制，byte/s，<=0为不限制
+func (rl *RateLimiter) Limit() int64 {
+	if rl == nil {
+		return 0
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return int64(rl.rate)
+}
+
+// reserve 预留n个令牌，返回需要等待的时间
+func (rl *RateLimiter) reserve(n int, now time.Time) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.rate <= 0 {
+		return 0
+	}
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > float64(rl.burst) {
+		rl.tokens = float64(rl.burst)
+	}
+	rl.last = now
+
+	rl.tokens -= float64(n)
+	if rl.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+}
+
+// WaitN 阻塞直到可以传输n个字节
+func (rl *RateLimiter) WaitN(n int) {
+	if rl == nil || n <= 0 {
+		return
+	}
+	if d := rl.reserve(n, time.Now()); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// maxRead 单次读取的最大字节数，不超过令牌桶容量
+func (rl *RateLimiter) maxRead(n int) int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.rate > 0 && int64(n) > rl.burst {
+		return int(rl.burst)
+	}
+	return n
+}
+
+// rateLimitedReader 受带宽限制的io.ReadCloser
+type rateLimitedReader struct {
+	r  io.Reader
+	rl *RateLimiter
+}
+
+// limitReader 使用带宽限制器包装r，rl为nil时原样返回
+func limitReader(r io.ReadCloser, rl *RateLimiter) io.ReadCloser {
+	if rl == nil {
+		return r
+	}
+	return &rateLimitedReader{r: r, rl: rl}
+}
+
+// Read 实现io.Reader
+func (lr *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p = p[:lr.rl.maxRead(len(p))]
+	n, err := lr.r.Read(p)
+	lr.rl.WaitN(n)
+	return n, err
+}
+
+// Close 实现io.Closer
+func (lr *rateLimitedReader) Close() error {
+	if c, ok := lr.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Seek 实现io.Seeker，底层reader不支持时返回错误
+func (lr *rateLimitedReader) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := lr.r.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, errors.New("underlying reader does not support Seek")
+}
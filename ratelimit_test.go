@@ -0,0 +1,30 @@
+package goharbor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_reserve(t *testing.T) {
+	rl := InitRateLimiter(1000, 500)
+	now := rl.last
+
+	if d := rl.reserve(500, now); d != 0 {
+		t.Errorf("burst reserve wait = %v, want 0", d)
+	}
+	if d := rl.reserve(250, now); d != 250*time.Millisecond {
+		t.Errorf("reserve wait = %v, want 250ms", d)
+	}
+	// 1秒后令牌最多恢复到burst
+	if d := rl.reserve(500, now.Add(time.Second)); d != 0 {
+		t.Errorf("reserve after refill wait = %v, want 0", d)
+	}
+	if got := rl.maxRead(4096); got != 500 {
+		t.Errorf("maxRead() = %v, want 500", got)
+	}
+
+	rl.SetLimit(0, 0)
+	if d := rl.reserve(1<<20, now); d != 0 {
+		t.Errorf("unlimited reserve wait = %v, want 0", d)
+	}
+}
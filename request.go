@@ -1,8 +1,10 @@
 package goharbor
 
 import (
+	"errors"
 	"net/url"
 	"strings"
+	"time"
 
 	"goharbor/grequests"
 
@@ -113,14 +115,75 @@ func (r RequestStruct) Req(method string, url string, ro *grequests.RequestOptio
 		return nil, err
 	}
 
+	span := r.startRequestSpan(method, url, ro)
+	start := time.Now()
+	resp, attempts, err := r.signAndDoFailover(method, url, fullPath, ro)
+	if err == nil && r.configs.DetectClockSkew {
+		// 根据服务器时间校正时钟偏差，签名过期时重新签名并重试一次
+		r.configs.clockSkew.update(resp, time.Now())
+		if isSignatureExpired(resp) && rewindRequestOptions(ro) {
+			var n int
+			resp, n, err = r.signAndDoFailover(method, url, fullPath, ro)
+			attempts += n
+		}
+	}
+
+	latency := time.Since(start)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	logRequest(r.configs.Logger, method, url, resp, err, attempts, latency)
+	observeRequest(r.configs, method, url, status, attempts, latency)
+	if span != nil {
+		setSpanAttributes(span, "http.status_code", status, "attempts", attempts)
+		if err == nil && resp != nil && !resp.Ok {
+			err2 := ResponseResult(resp)
+			span.RecordError(*err2)
+		}
+		endSpan(span, err)
+	}
+	return resp, err
+}
+
+// startRequestSpan 开始一个请求片段，并将追踪请求头加入请求
+func (r RequestStruct) startRequestSpan(method, url string, ro *grequests.RequestOptions) Span {
+	tracer := r.configs.Tracer
+	if tracer == nil {
+		return nil
+	}
+	span := tracer.StartSpan(r.configs.span, "HTTP "+method)
+	setSpanAttributes(span, "http.method", method, "http.url", url)
+	if ro.Headers == nil {
+		ro.Headers = map[string]string{}
+	}
+	for k, v := range span.Headers() {
+		ro.Headers[k] = v
+	}
+	return span
+}
+
+// signAndDo 签名并发送请求
+func (r RequestStruct) signAndDo(method, url, fullPath string, ro *grequests.RequestOptions) (*grequests.Response, error) {
 	configs := r.configs
+	if configs.transportErr != nil {
+		return nil, configs.transportErr
+	}
 	ak := AuthKey{AccessKey: configs.Accesskey, SecretKey: configs.Secretkey}
-	authKey := ak.Key(fullPath, method, 3600)
+	authKey := ak.KeyWithDeadline(fullPath, method, signatureDeadline(configs, time.Now()))
 	if ro.Headers == nil {
 		ro.Headers = map[string]string{}
 	}
 	ro.Headers["Authorization"] = authKey
-	return grequests.DoRegularRequest(method, url, ro)
+	if ro.HTTPClient == nil {
+		ro.HTTPClient = configs.HTTPClient
+	}
+	h := chainMiddlewares(configs.Middlewares, sendRequest)
+	resp, err := h(&APIRequest{Method: method, URL: url, Options: ro})
+	if err == nil && resp == nil {
+		return nil, errors.New("request middleware returned neither a response nor an error")
+	}
+	return resp, err
 }
 
 // Get takes 2 parameters and returns a Response struct.
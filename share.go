@@ -0,0 +1,143 @@
+package goharbor
+
+import (
+	"net/http"
+	"time"
+
+	"goharbor/grequests"
+)
+
+// ShareReturn 对象或目录分享设置和查询的返回结果
+// 分享设置接口的响应只包含结果描述，分享信息从设置后的元数据中读取
+type ShareReturn struct {
+	Results
+	BucketName string
+	PathName   string     // 桶下全路径对象或目录名称
+	Shared     bool       // 是否公开分享中
+	ShareURL   string     // 公开分享的下载url，即元数据的download_url，服务器未返回时为""
+	Permission Permission // 当前访问权限，读取元数据失败时为PermissionUnknown
+	// ExpiresAt 分享截止时间，由分享天数和服务器设置分享的时间（响应的Date头）计算；
+	// 永久公开、未公开时为零值，元数据中没有分享天数，GetShareInfo返回的也为零值
+	ExpiresAt time.Time
+}
+
+// IsExpired 分享在t时刻是否已过期，截止时间未知时为false
+func (r ShareReturn) IsExpired(t time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !t.Before(r.ExpiresAt)
+}
+
+// shareExpiry 由分享天数和响应的Date头计算分享截止时间，永久公开、未公开或服务器未返回Date时为零值
+func shareExpiry(resp *grequests.Response, share bool, days int) time.Time {
+	if !share || days <= 0 {
+		return time.Time{}
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return time.Time{}
+	}
+	return date.Add(time.Duration(days) * 24 * time.Hour)
+}
+
+// permissionResult 访问权限设置的结果
+func permissionResult(resp *grequests.Response, failText string) *Results {
+	result := ResponseResult(resp)
+	if resp.StatusCode != 200 {
+		result.Ok = false
+		if result.CodeText == "" {
+			result.CodeText = failText
+		}
+	}
+	return result
+}
+
+// setObjectPermission 设置对象访问权限，返回设置结果和分享截止时间
+func (client ClientStruct) setObjectPermission(bucketName, objPathName string, share bool, days int) (*Results, time.Time, error) {
+
+	dirPath, objName := CutPathAndName(objPathName)
+	resp, err := client.API.ObjectPermission(bucketName, dirPath, objName, share, days)
+	client.API.configs.Cache.invalidatePath(bucketName, objPathName)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return permissionResult(resp, "Failed to share object"), shareExpiry(resp, share, days), nil
+}
+
+// fromMetadata 从元数据获取分享信息
+func (r *ShareReturn) fromMetadata(m MetadataStruct) {
+	r.Permission = m.Permission
+	r.Shared = m.Permission.IsPublic()
+	if r.Shared {
+		r.ShareURL = m.DownloadURL
+	}
+}
+
+// SetObjectPermission 对象公有或私有访问权限设置，返回设置后的分享信息
+// 与ObjectPermission相同，设置成功后再读取一次元数据；与SetDirPermission、GetShareInfo返回相同的结构
+// param bucket_name: 桶名称
+// param objPathName: 桶下全路径对象名称
+// param share: 是否分享公开，用于设置对象公有或私有, true(公有)，false(私有)
+// param days: 对象公开分享天数(share=true时有效)，0表示永久公开，负数表示不公开
+func (client ClientStruct) SetObjectPermission(bucketName, objPathName string, share bool, days int) (*ShareReturn, error) {
+
+	r, expires, err := client.setObjectPermission(bucketName, objPathName, share, days)
+	if err != nil {
+		return nil, err
+	}
+	return client.shareReturn(*r, bucketName, objPathName, expires)
+}
+
+// SetDirPermission 目录公有或私有访问权限设置，用于分享整个目录，返回设置后的分享信息
+// param bucket_name: 桶名称
+// param dirPathName: 桶下全路径目录名称
+// param share: 是否分享公开，用于设置目录公有或私有, true(公有)，false(私有)
+// param days: 目录公开分享天数(share=true时有效)，0表示永久公开，负数表示不公开
+func (client ClientStruct) SetDirPermission(bucketName, dirPathName string, share bool, days int) (*ShareReturn, error) {
+
+	dirPath, dirName := CutPathAndName(buildPath([]string{dirPathName}))
+	resp, err := client.API.DirPermission(bucketName, dirPath, dirName, share, days)
+	client.API.configs.Cache.invalidateTree(bucketName, dirPathName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := permissionResult(resp, "Failed to share directory")
+	return client.shareReturn(*result, bucketName, dirPathName, shareExpiry(resp, share, days))
+}
+
+// shareReturn 分享设置返回值构建，设置成功时读取元数据获取分享信息
+// 读取元数据失败时仍返回设置的结果，Permission为PermissionUnknown
+func (client ClientStruct) shareReturn(result Results, bucketName, pathName string, expires time.Time) (*ShareReturn, error) {
+	ret := &ShareReturn{Results: result, BucketName: bucketName, PathName: pathName}
+	if !result.Ok {
+		return ret, nil
+	}
+	info, err := client.GetShareInfo(bucketName, pathName)
+	if err != nil {
+		return nil, err
+	}
+	if info.Ok {
+		info.Results = result
+		if info.Shared {
+			info.ExpiresAt = expires
+		}
+		return info, nil
+	}
+	return ret, nil
+}
+
+// GetShareInfo 查询对象或目录当前的分享信息，不使用元数据缓存
+// param bucket_name: 桶名称
+// param pathName: 桶下全路径对象或目录名称
+func (client ClientStruct) GetShareInfo(bucketName, pathName string) (*ShareReturn, error) {
+
+	meta, err := client.WithCache(nil).GetMetadata(bucketName, pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &ShareReturn{Results: meta.Results, BucketName: bucketName, PathName: pathName}
+	if meta.Ok {
+		ret.fromMetadata(meta.Obj)
+	}
+	return ret, nil
+}
@@ -0,0 +1,77 @@
+package goharbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Share(t *testing.T) {
+	var dirQuery string
+	permission := "私有"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Date", "Sun, 18 Oct 2020 08:00:00 GMT")
+		switch {
+		case r.Method == "PATCH" && strings.HasPrefix(r.URL.Path, "/api/v1/obj/b/a/x.txt"):
+			permission = "公有"
+			w.Write([]byte(`{"code_text": "对象共享设置成功"}`))
+		case r.Method == "PATCH" && strings.HasPrefix(r.URL.Path, "/api/v1/dir/b/a/"):
+			dirQuery = r.URL.RawQuery
+			w.Write([]byte(`{"code_text": "目录共享设置成功"}`))
+		case r.Method == "GET" && r.URL.Path == "/api/v1/metadata/b/a/x.txt/":
+			w.Write([]byte(`{"bucket_name": "b", "dir_path": "a", "obj": {"na": "a/x.txt", "name": "x.txt", "fod": true,
+				"download_url": "https://evharbor/share/obs/b/a/x.txt", "access_permission": "` + permission + `"}}`))
+		case r.Method == "GET" && r.URL.Path == "/api/v1/metadata/b/a/":
+			w.Write([]byte(`{"bucket_name": "b", "dir_path": "", "obj": {"na": "a", "name": "a", "fod": false, "access_permission": "公有"}}`))
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"code_text": "不存在"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := testClient(server.URL)
+
+	r, err := client.GetShareInfo("b", "a/x.txt")
+	if err != nil || !r.Ok || r.Shared || r.ShareURL != "" || r.Permission != PermissionPrivate {
+		t.Fatalf("GetShareInfo() = %+v, %v", r, err)
+	}
+
+	// ObjectPermission仍返回Results
+	res, err := client.ObjectPermission("b", "a/x.txt", true, 7)
+	if err != nil || !res.Ok || res.CodeText != "对象共享设置成功" {
+		t.Fatalf("ObjectPermission() = %+v, %v", res, err)
+	}
+
+	r, err = client.SetObjectPermission("b", "a/x.txt", true, 7)
+	if err != nil || !r.Ok || !r.Shared || r.Permission != PermissionPublicRead || r.ShareURL != "https://evharbor/share/obs/b/a/x.txt" {
+		t.Fatalf("SetObjectPermission() = %+v, %v", r, err)
+	}
+	// 截止时间由分享天数和服务器的Date头计算
+	setAt := time.Date(2020, 10, 18, 8, 0, 0, 0, time.UTC)
+	if !r.ExpiresAt.Equal(setAt.AddDate(0, 0, 7)) || r.IsExpired(setAt.AddDate(0, 0, 6)) || !r.IsExpired(setAt.AddDate(0, 0, 7)) {
+		t.Errorf("ExpiresAt = %v", r.ExpiresAt)
+	}
+	if r, err := client.SetObjectPermission("b", "a/x.txt", true, 0); err != nil || !r.Ok || !r.ExpiresAt.IsZero() {
+		t.Errorf("permanent share = %+v, %v", r, err)
+	}
+	if r, err := client.GetShareInfo("b", "a/x.txt"); err != nil || !r.Shared || !r.ExpiresAt.IsZero() {
+		t.Errorf("GetShareInfo() = %+v, %v", r, err)
+	}
+
+	r, err = client.SetDirPermission("b", "a", true, 30)
+	if err != nil || !r.Ok || !r.Shared || r.CodeText != "目录共享设置成功" || !r.ExpiresAt.Equal(time.Date(2020, 11, 17, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("SetDirPermission() = %+v, %v", r, err)
+	}
+	if !strings.Contains(dirQuery, "share=true") || !strings.Contains(dirQuery, "days=30") {
+		t.Errorf("dir query = %s", dirQuery)
+	}
+
+	r, err = client.SetObjectPermission("b", "nothing.txt", false, 0)
+	if err != nil || r.Ok || r.Code != 404 || r.CodeText != "不存在" {
+		t.Errorf("SetObjectPermission() on missing object = %+v, %v", r, err)
+	}
+}
@@ -0,0 +1,169 @@
+package goharbor
+
+import (
+	"errors"
+	"io"
+)
+
+// streamChunkSize 流式上传下载的数据块大小
+const streamChunkSize = 1024 * 1024 * 5 //5Mb
+
+// objectReader 按数据块顺序下载对象数据的流
+type objectReader struct {
+	client      ClientStruct
+	bucketName  string
+	objPathName string
+	offset      int64 // 下一个数据块的偏移量
+	size        int64 // 对象大小，-1为未知
+	version     downloadVersion
+	buf         []byte
+	closed      bool
+}
+
+// openObjectReader 打开对象并下载第一个数据块，对象不存在等错误在打开时返回
+func (client ClientStruct) openObjectReader(bucketName, objPathName string) (*objectReader, error) {
+	r := &objectReader{client: client, bucketName: bucketName, objPathName: objPathName, size: -1}
+	if err := r.fill(); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return r, nil
+}
+
+// fill 下载下一个数据块
+func (r *objectReader) fill() error {
+	if r.size >= 0 && r.offset >= r.size {
+		return io.EOF
+	}
+	cr, err := r.client.downloadChunk(r.bucketName, r.objPathName, r.offset, streamChunkSize, &r.version)
+	if err != nil {
+		return err
+	}
+	if !cr.Ok {
+		return cr.Results
+	}
+	r.size = cr.ObjSize
+	if len(cr.Chunk) == 0 {
+		if r.offset < r.size {
+			return io.ErrUnexpectedEOF
+		}
+		return io.EOF
+	}
+	r.buf = cr.Chunk
+	r.offset += int64(len(cr.Chunk))
+	return nil
+}
+
+// Read 实现io.Reader
+func (r *objectReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, errors.New("read from closed object reader")
+	}
+	for len(r.buf) == 0 {
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close 实现io.Closer
+func (r *objectReader) Close() error {
+	r.closed = true
+	r.buf = nil
+	return nil
+}
+
+// OpenObject 打开一个对象用于顺序读取，数据按数据块在读取时下载
+// 配置了Compression时透明地解压压缩上传的对象，见WithCompression
+// param bucketName: 桶名称
+// param objPathName: 桶下全路径对象名称
+func (client ClientStruct) OpenObject(bucketName, objPathName string) (io.ReadCloser, error) {
+	rc, _, _, err := client.openObject(bucketName, objPathName)
+	return rc, err
+}
+
+// UploadReader 从io.Reader流式上传一个对象，数据按数据块上传
+// 配置了Compression时在客户端压缩后上传，对象名称加上编码后缀，已有的压缩对象先被删除
+// param bucketName: 桶名称
+// param objPathName: 桶下全路径对象名称
+// param reader: 对象数据
+func (client ClientStruct) UploadReader(bucketName, objPathName string, reader io.Reader) (*ObjReturn, error) {
+
+	client, span := client.startSpan("UploadReader", "bucket", bucketName, "object", objPathName)
+	ret, err := client.uploadReader(bucketName, objPathName, reader)
+	endObjSpan(span, ret, err)
+	return ret, err
+}
+
+// uploadReader 从io.Reader流式上传一个对象
+func (client ClientStruct) uploadReader(bucketName, objPathName string, reader io.Reader) (*ObjReturn, error) {
+	if codec := client.API.configs.Compression; codec != nil {
+		objPathName = compressedName(codec, objPathName)
+		// 压缩数据比已有对象短时，残留的旧数据会导致解压失败
+		r, err := client.resetObject(bucketName, objPathName)
+		if err != nil {
+			return nil, err
+		}
+		if !r.Ok {
+			return &ObjReturn{Results: *r, ObjSize: -1}, nil
+		}
+		cr := compressReader(codec, reader)
+		defer cr.Close()
+		reader = cr
+	}
+	return client.uploadStream(bucketName, objPathName, reader)
+}
+
+// uploadStream 按数据块上传流中的数据，对象大小在读取结束时才确定
+func (client ClientStruct) uploadStream(bucketName, objPathName string, reader io.Reader) (*ObjReturn, error) {
+	var offset int64
+	ret := &ObjReturn{ObjSize: -1}
+	var retErr error
+	buf := make([]byte, streamChunkSize)
+	var encKey *objectKey
+	pt := newProgressTracker(client.GetConfigs(), true, bucketName, objPathName, 0, -1)
+	pt.start()
+	for {
+		n, err := io.ReadFull(reader, buf)
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			retErr = err
+			break
+		}
+		// 空的流也上传一个空数据块以创建对象
+		if n > 0 || offset == 0 {
+			r, err := client.uploadChunk(bucketName, objPathName, offset, buf[:n], &encKey)
+			if err != nil {
+				retErr = err
+				break
+			}
+			if !r.Ok {
+				ret.Results = *r
+				break
+			}
+			pt.chunkDone(offset, int64(n))
+			offset += int64(n)
+		}
+		if eof {
+			r, err := client.finishEncryptedUpload(bucketName, objPathName, offset, &encKey)
+			if err != nil {
+				retErr = err
+				break
+			}
+			if !r.Ok {
+				ret.Results = *r
+				break
+			}
+			ret.ObjSize = offset
+			pt.setTotal(offset)
+			ret.CodeText = "upload ok"
+			ret.Ok = true
+			break
+		}
+	}
+	ret.Offset = offset
+	pt.finish(ret.Ok, progressErr(ret, retErr))
+	return ret, retErr
+}
@@ -0,0 +1,215 @@
+package goharbor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testClient 访问测试服务的client
+// param serverURL: httptest.Server的url
+func testClient(serverURL string) ClientStruct {
+	configs, _ := InitConfig(map[ConfigKeyType]string{
+		SCHEME:    HTTP,
+		HOST:      strings.TrimPrefix(serverURL, "http://"),
+		ACCESSKEY: "666666",
+		SECRETKEY: "888888",
+	})
+	return InitClient(configs)
+}
+
+// memObjectServer 在内存中保存对象的测试服务，支持分片上传、下载、删除和元数据
+type memObjectServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	objects  map[string][]byte // "bucket/path" -> 数据
+	modified map[string]int    // "bucket/path" -> 修改次数
+	uploads  int               // 上传的数据块数
+}
+
+func newMemObjectServer() *memObjectServer {
+	s := &memObjectServer{objects: make(map[string][]byte), modified: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *memObjectServer) get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	return data, ok
+}
+
+func (s *memObjectServer) set(key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = data
+}
+
+func (s *memObjectServer) client() ClientStruct {
+	return testClient(s.URL)
+}
+
+func (s *memObjectServer) serve(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/api/v1/obj/"
+	if strings.HasPrefix(r.URL.Path, "/api/v1/metadata/") {
+		s.serveMetadata(w, strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/metadata/"), "/"))
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/v1/dir/") && r.Method == http.MethodGet {
+		s.serveList(w, strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/dir/"), "/"))
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(404)
+		return
+	}
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		f, _, err := r.FormFile("chunk")
+		if err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		chunk, _ := ioutil.ReadAll(f)
+		offset, _ := strconv.Atoi(r.FormValue("chunk_offset"))
+		data := s.objects[key]
+		if len(data) < offset+len(chunk) {
+			data = append(data, make([]byte, offset+len(chunk)-len(data))...)
+		}
+		copy(data[offset:], chunk)
+		s.objects[key] = data
+		s.modified[key]++
+		s.uploads++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code_text": "ok"}`))
+	case http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(404)
+			w.Write([]byte(`{"code_text": "not found"}`))
+			return
+		}
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		if offset > len(data) {
+			offset = len(data)
+		}
+		if offset+size > len(data) {
+			size = len(data) - offset
+		}
+		w.Header().Set("evob_chunk_size", strconv.Itoa(size))
+		w.Header().Set("evob_obj_size", strconv.Itoa(len(data)))
+		w.Write(data[offset : offset+size])
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(204)
+	}
+}
+
+func (s *memObjectServer) serveMetadata(w http.ResponseWriter, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	data, ok := s.objects[key]
+	if !ok {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"code_text": "not found"}`))
+		return
+	}
+	fmt.Fprintf(w, `{"obj": {"na": %q, "fod": true, "si": %d, "ult": "2020-10-18 08:00:00", "upt": "2020-10-18 08:00:%02d"}}`,
+		key, len(data), s.modified[key]%60)
+}
+
+// serveList 列举目录，目录由对象路径隐含
+func (s *memObjectServer) serveList(w http.ResponseWriter, dirKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket := strings.SplitN(dirKey, "/", 2)[0]
+	children := make(map[string]int) // 名称 -> 对象大小，-1为目录
+	for key, data := range s.objects {
+		if !strings.HasPrefix(key, dirKey+"/") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(key, dirKey+"/"), "/", 2)
+		if len(parts) == 2 {
+			children[parts[0]] = -1
+		} else {
+			children[parts[0]] = len(data)
+		}
+	}
+	if len(children) == 0 && dirKey != bucket {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		w.Write([]byte(`{"code_text": "not found"}`))
+		return
+	}
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var files []string
+	for _, name := range names {
+		pathName := strings.TrimPrefix(strings.TrimPrefix(dirKey, bucket)+"/"+name, "/")
+		size, isObj := children[name], children[name] >= 0
+		if !isObj {
+			size = 0
+		}
+		files = append(files, fmt.Sprintf(`{"na": %q, "name": %q, "fod": %v, "si": %d, "ult": "2020-10-18 08:00:00"}`,
+			pathName, name, isObj, size))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"files": [%s], "count": %d}`, strings.Join(files, ","), len(files))
+}
+
+func TestUploadReaderAndOpenObject(t *testing.T) {
+	server := newMemObjectServer()
+	defer server.Close()
+	client := server.client()
+
+	content := bytes.Repeat([]byte("0123456789"), streamChunkSize/10+100)
+	ret, err := client.UploadReader("b", "a/x.bin", bytes.NewReader(content))
+	if err != nil || !ret.IsDone() || ret.ObjSize != int64(len(content)) {
+		t.Fatalf("UploadReader() = %+v, %v", ret, err)
+	}
+	if data, _ := server.get("b/a/x.bin"); !bytes.Equal(data, content) {
+		t.Fatalf("uploaded %d bytes, want %d", len(data), len(content))
+	}
+
+	rc, err := client.OpenObject("b", "a/x.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("OpenObject() read %d bytes, %v", len(got), err)
+	}
+
+	// 空的流创建空对象
+	if ret, err := client.UploadReader("b", "a/empty", strings.NewReader("")); err != nil || !ret.Ok {
+		t.Fatalf("UploadReader(empty) = %+v, %v", ret, err)
+	}
+	if data, ok := server.get("b/a/empty"); !ok || len(data) != 0 {
+		t.Errorf("empty object = %q, %v", data, ok)
+	}
+
+	if _, err := client.OpenObject("b", "a/missing"); err == nil {
+		t.Error("OpenObject() of a missing object should fail")
+	} else if res, ok := err.(Results); !ok || res.Code != 404 {
+		t.Errorf("OpenObject() error = %#v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package goharbor
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Span 一个追踪片段
+type Span interface {
+	// SetAttribute 设置片段属性
+	SetAttribute(key string, value interface{})
+	// RecordError 记录错误
+	RecordError(err error)
+	// End 结束片段
+	End()
+	// Headers 需要传播给服务器的追踪请求头，如W3C traceparent
+	Headers() map[string]string
+}
+
+// Tracer 创建追踪片段，可对接OpenTelemetry等追踪系统
+type Tracer interface {
+	// StartSpan 开始一个片段，parent为nil时开始一个新的追踪
+	StartSpan(parent Span, name string) Span
+}
+
+// startSpan 开始一个片段，返回以该片段为父片段的client副本；未配置Tracer时返回nil片段
+// param kv: 片段属性，键值对交替
+func (client ClientStruct) startSpan(name string, kv ...interface{}) (ClientStruct, Span) {
+	configs := &client.API.configs
+	if configs.Tracer == nil {
+		return client, nil
+	}
+	span := configs.Tracer.StartSpan(configs.span, name)
+	setSpanAttributes(span, kv...)
+	configs.span = span
+	return client, span
+}
+
+// setSpanAttributes 设置片段属性
+// param kv: 键值对交替
+func setSpanAttributes(span Span, kv ...interface{}) {
+	if span == nil {
+		return
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if key, ok := kv[i].(string); ok {
+			span.SetAttribute(key, kv[i+1])
+		}
+	}
+}
+
+// endSpan 记录错误并结束片段
+func endSpan(span Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// endResultSpan 根据请求结果结束片段，失败的结果也记录为错误
+func endResultSpan(span Span, r *Results, err error) {
+	if span == nil {
+		return
+	}
+	if err == nil && r != nil {
+		span.SetAttribute("ok", r.Ok)
+		span.SetAttribute("code", r.Code)
+		if !r.Ok {
+			err = *r
+		}
+	}
+	endSpan(span, err)
+}
+
+// endObjSpan 根据对象上传下载结果结束片段
+func endObjSpan(span Span, ret *ObjReturn, err error) {
+	if span == nil {
+		return
+	}
+	if ret != nil {
+		span.SetAttribute("offset", ret.Offset)
+		span.SetAttribute("obj_size", ret.ObjSize)
+		endResultSpan(span, &ret.Results, err)
+		return
+	}
+	endSpan(span, err)
+}
+
+// SpanData 一个已结束片段的数据
+type SpanData struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string // 根片段为""
+	Name         string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	Errors       []error
+}
+
+// SimpleTracer Tracer的简单实现，使用W3C traceparent请求头传播，片段结束时回调片段数据
+type SimpleTracer struct {
+	onEnd func(SpanData)
+}
+
+// InitSimpleTracer 初始化一个简单追踪器
+// param onEnd: 片段结束时的回调，可以为nil
+func InitSimpleTracer(onEnd func(SpanData)) *SimpleTracer {
+	return &SimpleTracer{onEnd: onEnd}
+}
+
+// StartSpan 实现Tracer
+func (t *SimpleTracer) StartSpan(parent Span, name string) Span {
+	s := &simpleSpan{
+		tracer: t,
+		data: SpanData{
+			SpanID:     randomHex(8),
+			Name:       name,
+			Start:      time.Now(),
+			Attributes: make(map[string]interface{}),
+		},
+	}
+	if p, ok := parent.(*simpleSpan); ok && p != nil {
+		s.data.TraceID = p.data.TraceID
+		s.data.ParentSpanID = p.data.SpanID
+	} else {
+		s.data.TraceID = randomHex(16)
+	}
+	return s
+}
+
+// simpleSpan SimpleTracer创建的片段
+type simpleSpan struct {
+	mu     sync.Mutex
+	tracer *SimpleTracer
+	data   SpanData
+	ended  bool
+}
+
+// SetAttribute 实现Span
+func (s *simpleSpan) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// RecordError 实现Span
+func (s *simpleSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Errors = append(s.data.Errors, err)
+}
+
+// End 实现Span
+func (s *simpleSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.tracer.onEnd != nil {
+		s.tracer.onEnd(data)
+	}
+}
+
+// Headers 实现Span
+func (s *simpleSpan) Headers() map[string]string {
+	return map[string]string{
+		"traceparent": "00-" + s.data.TraceID + "-" + s.data.SpanID + "-01",
+	}
+}
+
+// randomHex 生成n字节的随机十六进制字符串
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
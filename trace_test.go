@@ -0,0 +1,55 @@
+package goharbor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestSimpleTracer_UploadObject(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	f, err := ioutil.TempFile("", "goharbor-trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("hello")
+	f.Close()
+
+	var mu sync.Mutex
+	spans := map[string]SpanData{}
+	tracer := InitSimpleTracer(func(s SpanData) {
+		mu.Lock()
+		spans[s.Name] = s
+		mu.Unlock()
+	})
+	client := testClient(server.URL).WithTracer(tracer)
+
+	r, err := client.UploadObject("b", "a/x.txt", f.Name(), 0)
+	if err != nil || !r.IsDone() {
+		t.Fatalf("UploadObject() = %+v, %v", r, err)
+	}
+
+	obj, chunk, req := spans["UploadObject"], spans["UploadOneChunk"], spans["HTTP POST"]
+	if obj.SpanID == "" || chunk.ParentSpanID != obj.SpanID || req.ParentSpanID != chunk.SpanID {
+		t.Fatalf("unexpected span tree: %+v", spans)
+	}
+	if chunk.TraceID != obj.TraceID || req.TraceID != obj.TraceID {
+		t.Error("spans should share the trace id")
+	}
+	if chunk.Attributes["size"] != 5 || chunk.Attributes["offset"] != int64(0) {
+		t.Errorf("chunk attributes = %v", chunk.Attributes)
+	}
+	if want := "00-" + req.TraceID + "-" + req.SpanID + "-01"; traceparent != want {
+		t.Errorf("traceparent = %q, want %q", traceparent, want)
+	}
+}
@@ -0,0 +1,139 @@
+package goharbor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TransportOptions 连接EVHarbor服务的传输配置，应用于全部api请求
+type TransportOptions struct {
+	CAFile              string        // 信任的CA证书文件(PEM)，用于私有CA签发的服务器证书
+	CAPEM               []byte        // 信任的CA证书内容(PEM)，与CAFile可同时使用
+	CertFile            string        // 客户端证书文件(PEM)，用于双向TLS认证
+	KeyFile             string        // 客户端证书私钥文件(PEM)
+	InsecureSkipVerify  bool          // 是否跳过服务器证书校验，仅用于测试
+	ProxyURL            string        // 代理url，如 http://proxy:3128；为空时使用环境变量HTTP_PROXY等
+	UnixSocket          string        // 通过Unix socket连接服务，不为空时忽略HOST的地址部分
+	DialTimeout         time.Duration // 建立连接的超时时间，0为30s
+	TLSHandshakeTimeout time.Duration // TLS握手的超时时间，0为10s
+	RequestTimeout      time.Duration // 单个请求（含读取响应体）的超时时间，0为不限制
+	// DialContext 自定义建立连接的函数，不为nil时忽略UnixSocket和DialTimeout
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// isZero 是否未设置任何传输配置
+func (opts TransportOptions) isZero() bool {
+	return opts.CAFile == "" && len(opts.CAPEM) == 0 && opts.CertFile == "" && opts.KeyFile == "" &&
+		!opts.InsecureSkipVerify && opts.ProxyURL == "" && opts.UnixSocket == "" && opts.DialTimeout == 0 &&
+		opts.TLSHandshakeTimeout == 0 && opts.RequestTimeout == 0 && opts.DialContext == nil
+}
+
+// InitHTTPClient 根据传输配置创建一个http client，可在多个ClientStruct间共享以复用连接
+func InitHTTPClient(opts TransportOptions) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+
+	if opts.CAFile != "" || len(opts.CAPEM) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if opts.CAFile != "" {
+			pem, err := ioutil.ReadFile(opts.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.New("no valid certificate found in CAFile")
+			}
+		}
+		if len(opts.CAPEM) > 0 && !pool.AppendCertsFromPEM(opts.CAPEM) {
+			return nil, errors.New("no valid certificate found in CAPEM")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, errors.New("CertFile and KeyFile must be configured together")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if opts.ProxyURL != "" {
+		u, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, errors.New("ProxyURL must be an absolute url, such as http://proxy:3128")
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	dialTimeout := opts.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = 30 * time.Second
+	}
+	tlsTimeout := opts.TLSHandshakeTimeout
+	if tlsTimeout <= 0 {
+		tlsTimeout = 10 * time.Second
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	dial := opts.DialContext
+	if dial == nil {
+		dial = dialer.DialContext
+		if opts.UnixSocket != "" {
+			socket := opts.UnixSocket
+			dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", socket)
+			}
+			// Unix socket不经过代理
+			proxy = nil
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dial,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   tlsTimeout,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{Transport: transport, Timeout: opts.RequestTimeout}, nil
+}
+
+// WithTransport 返回一个使用指定传输配置的client副本
+// param opts: 传输配置
+func (client ClientStruct) WithTransport(opts TransportOptions) (ClientStruct, error) {
+	hc, err := InitHTTPClient(opts)
+	if err != nil {
+		return client, err
+	}
+	client.API.configs.Transport = opts
+	client.API.configs.HTTPClient = hc
+	client.API.configs.transportErr = nil
+	return client, nil
+}
+
+// WithHTTPClient 返回一个使用指定http client发送请求的client副本
+// param hc: http client，nil使用默认client
+func (client ClientStruct) WithHTTPClient(hc *http.Client) ClientStruct {
+	client.API.configs.HTTPClient = hc
+	client.API.configs.transportErr = nil
+	return client
+}
@@ -0,0 +1,124 @@
+package goharbor
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTransportTestClient(t *testing.T, scheme, host string, extra map[ConfigKeyType]string) (ClientStruct, error) {
+	c := map[ConfigKeyType]string{
+		SCHEME:    scheme,
+		HOST:      host,
+		ACCESSKEY: "666666",
+		SECRETKEY: "888888",
+	}
+	for k, v := range extra {
+		c[k] = v
+	}
+	configs, err := InitConfig(c)
+	return InitClient(configs), err
+}
+
+func Test_TransportCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未信任私有CA
+	client, _ := newTransportTestClient(t, HTTPS, host, nil)
+	if _, err := client.DeleteObject("b", "a.txt"); err == nil {
+		t.Error("expected certificate error without CAFILE")
+	}
+
+	client, err := newTransportTestClient(t, HTTPS, host, map[ConfigKeyType]string{CAFILE: caFile, REQUESTTIMEOUT: "5s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.GetConfigs().HTTPClient.Timeout != 5*time.Second {
+		t.Errorf("Timeout = %v", client.GetConfigs().HTTPClient.Timeout)
+	}
+	if r, err := client.DeleteObject("b", "a.txt"); err != nil || !r.Ok {
+		t.Errorf("DeleteObject() with CAFILE = %+v, %v", r, err)
+	}
+
+	client, _ = newTransportTestClient(t, HTTPS, host, map[ConfigKeyType]string{INSECURESKIPVERIFY: "true"})
+	if r, err := client.DeleteObject("b", "a.txt"); err != nil || !r.Ok {
+		t.Errorf("DeleteObject() with INSECURESKIPVERIFY = %+v, %v", r, err)
+	}
+}
+
+func Test_TransportUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "harbor.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix socket not supported:", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	})}
+	go server.Serve(l)
+	defer server.Close()
+
+	client, _ := newTransportTestClient(t, HTTP, "evharbor.local", nil)
+	client, err = client.WithTransport(TransportOptions{UnixSocket: socket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := client.DeleteObject("b", "a.txt"); err != nil || !r.Ok {
+		t.Errorf("DeleteObject() over unix socket = %+v, %v", r, err)
+	}
+}
+
+func Test_TransportInvalid(t *testing.T) {
+	for _, extra := range []map[ConfigKeyType]string{
+		{CAFILE: "/nonexistent/ca.pem"},
+		{CERTFILE: "/nonexistent/cert.pem"},
+		{PROXY: "proxy:3128"},
+		{DIALTIMEOUT: "ten seconds"},
+		{INSECURESKIPVERIFY: "maybe"},
+	} {
+		if _, err := newTransportTestClient(t, HTTPS, "localhost", extra); err == nil {
+			t.Errorf("InitConfig(%v) expected error", extra)
+		}
+	}
+}
+
+func Test_TransportSetDirectly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	// 不经过InitConfig或WithTransport直接设置Transport
+	dials := 0
+	configs := testClient(server.URL).GetConfigs()
+	configs.Transport = TransportOptions{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials++
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}}
+	client := InitClient(configs)
+	if r, err := client.DeleteObject("b", "a.txt"); err != nil || !r.Ok || dials != 1 {
+		t.Errorf("DeleteObject() = %+v, %v, dials %d", r, err, dials)
+	}
+
+	configs.Transport = TransportOptions{CAFile: "/nonexistent/ca.pem"}
+	if _, err := InitClient(configs).DeleteObject("b", "a.txt"); err == nil {
+		t.Error("invalid Transport should fail requests")
+	}
+}
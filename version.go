@@ -0,0 +1,98 @@
+package goharbor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+)
+
+// APIV1 EVHarbor API v1
+const APIV1 string = "v1"
+
+// SupportedAPIVersions 客户端实现了url构建和响应解码的API版本，由新到旧
+// 目前只有v1有公开的接口定义；v2的接口定义确定后，在apiVersionSpecs中注册其url构建和响应解码即可
+var SupportedAPIVersions = []string{APIV1}
+
+// apiVersionSpec 一个API版本的url和响应格式
+type apiVersionSpec struct {
+	// path 构建api路径（未编码），如 api/v1/obj/bucket/a/b
+	path func(configs *ConfigStruct, prefix string, parts []string) string
+	// decode 解码响应json到MetadataStruct等结构体
+	decode func(data []byte, v interface{}) error
+}
+
+// apiPathV1 api/<version>/<prefix>/<parts...>
+func apiPathV1(configs *ConfigStruct, prefix string, parts []string) string {
+	slice := append([]string{"api", configs.Version, prefix}, parts...)
+	return buildPath(slice)
+}
+
+// apiVersionSpecs 各API版本的url和响应格式
+var apiVersionSpecs = map[string]apiVersionSpec{
+	APIV1: {
+		path:   apiPathV1,
+		decode: json.Unmarshal,
+	},
+}
+
+// getAPIVersionSpec 获取配置的API版本的格式，未注册的版本按v1的格式处理，版本号仍拼接到url中
+func getAPIVersionSpec(configs *ConfigStruct) apiVersionSpec {
+	if spec, ok := apiVersionSpecs[configs.Version]; ok {
+		return spec
+	}
+	return apiVersionSpecs[APIV1]
+}
+
+// decodeResponse 按配置的API版本解码响应json
+func decodeResponse(configs ConfigStruct, data []byte, v interface{}) error {
+	return getAPIVersionSpec(&configs).decode(data, v)
+}
+
+// WithVersion 返回一个使用指定API版本的client副本
+// param version: API版本号，如 APIV1；未在SupportedAPIVersions中的版本按v1的url结构和响应格式处理
+func (client ClientStruct) WithVersion(version string) ClientStruct {
+	client.API.configs.Version = version
+	return client
+}
+
+// ServerVersions 探测服务器支持的API版本
+// EVHarbor没有版本列表api，逐个请求客户端支持的版本的桶列表api：
+// 2xx为支持，404、405、501为不支持，其他状态码（如401、500）无法判断，返回Results错误
+func (client ClientStruct) ServerVersions() ([]string, error) {
+	var versions []string
+	for _, v := range SupportedAPIVersions {
+		c := client.WithVersion(v)
+		b := apiBuilderStruct{configs: c.API.configs}
+		resp, err := RequestStruct{configs: c.API.configs}.Get(b.buildBucketAPI("", nil), nil)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			versions = append(versions, v)
+		case isUnsupportedAPI(resp.StatusCode):
+		default:
+			// 认证失败或服务器错误时无法判断是否支持
+			return nil, *ResponseResult(resp)
+		}
+	}
+	return versions, nil
+}
+
+// NegotiateVersion 探测服务器支持的API版本，返回一个使用双方都支持的最新版本的client副本
+func (client ClientStruct) NegotiateVersion() (ClientStruct, error) {
+	versions, err := client.ServerVersions()
+	if err != nil {
+		return client, err
+	}
+	server := make(map[string]bool, len(versions))
+	for _, v := range versions {
+		server[v] = true
+	}
+	for _, v := range SupportedAPIVersions {
+		if server[v] {
+			return client.WithVersion(v), nil
+		}
+	}
+	return client, errors.New("no API version supported by both client and server at " + (&url.URL{Scheme: client.API.configs.Scheme, Host: client.API.configs.Host}).String())
+}
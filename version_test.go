@@ -0,0 +1,60 @@
+package goharbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_decodeResponse(t *testing.T) {
+	ret := ListDirReturn{}
+	err := decodeResponse(ConfigStruct{Version: APIV1}, []byte(`{"files": [{"na": "a/y.txt", "si": 9007199254740993}]}`), &ret)
+	if err != nil || len(ret.Files) != 1 || ret.Files[0].PathName != "a/y.txt" || ret.Files[0].Size != 9007199254740993 {
+		t.Errorf("v1 files = %+v, %v", ret.Files, err)
+	}
+
+	// 未注册的版本按v1的格式解码，版本号仍拼接到url中
+	c := ConfigStruct{Version: "v9", Scheme: HTTP, Host: "h", APIObjPrefix: "obj"}
+	ret = ListDirReturn{}
+	if err := decodeResponse(c, []byte(`{"files": [{"na": "a/z.txt"}]}`), &ret); err != nil || ret.Files[0].PathName != "a/z.txt" {
+		t.Errorf("v9 files = %+v, %v", ret.Files, err)
+	}
+	if u := (apiBuilderStruct{configs: c}).buildObjAPI("b", "a", "z.txt", nil); u != "http://h/api/v9/obj/b/a/z.txt/" {
+		t.Errorf("v9 url = %s", u)
+	}
+}
+
+func Test_NegotiateVersion(t *testing.T) {
+	probeStatus := 200
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/v1/"):
+			w.WriteHeader(probeStatus)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	client := testClient(server.URL).WithVersion("v0")
+
+	// 逐个探测客户端支持的版本
+	c, err := client.NegotiateVersion()
+	if err != nil || c.GetConfigs().Version != APIV1 {
+		t.Errorf("NegotiateVersion() = %s, %v", c.GetConfigs().Version, err)
+	}
+	if client.GetConfigs().Version != "v0" {
+		t.Errorf("original client version changed to %s", client.GetConfigs().Version)
+	}
+
+	// 认证失败时无法判断服务器是否支持
+	probeStatus = 401
+	if versions, err := client.ServerVersions(); err == nil {
+		t.Errorf("ServerVersions() with 401 = %v", versions)
+	}
+	probeStatus = 404
+	if _, err := client.NegotiateVersion(); err == nil {
+		t.Error("NegotiateVersion() without a common version should fail")
+	}
+}
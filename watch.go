@@ -0,0 +1,527 @@
+package goharbor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatchEventType 目录监视事件类型
+type WatchEventType uint8
+
+const (
+	// WatchUploaded 新建或修改的文件已上传
+	WatchUploaded WatchEventType = iota
+	// WatchDeleted 本地已删除的文件对应的对象已删除（MirrorDelete）
+	WatchDeleted
+	// WatchFailed 上传或删除失败，上传失败的文件会在下一个稳定周期后重试
+	WatchFailed
+)
+
+// String 事件名称
+func (e WatchEventType) String() string {
+	switch e {
+	case WatchUploaded:
+		return "uploaded"
+	case WatchDeleted:
+		return "deleted"
+	case WatchFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// WatchEvent 目录监视事件
+type WatchEvent struct {
+	Type        WatchEventType
+	LocalPath   string // 本地文件全路径
+	ObjPathName string // 桶下全路径对象名称
+	Err         error  // 失败时的错误信息
+}
+
+// WatchOptions 目录监视选项
+type WatchOptions struct {
+	LocalDir     string                                      // 监视的本地目录，包括子目录
+	BucketName   string                                      // 桶名称
+	RemoteDir    string                                      // 本地目录映射到的桶下目录，""为桶根目录
+	StableFor    time.Duration                               // 文件大小和修改时间在此时间内不变才上传，<=0时为2s
+	PollInterval time.Duration                               // 检查文件是否稳定的间隔，轮询模式下同时为扫描间隔，<=0时为1s
+	ForcePolling bool                                        // 不使用inotify，始终轮询扫描
+	InitialSync  bool                                        // 启动时上传目录中已有的文件，否则只上传启动后的变化
+	MirrorDelete bool                                        // 本地文件删除时删除对应的对象
+	Filter       func(relPath string, info os.FileInfo) bool // 返回false时忽略该文件，relPath以"/"分隔；可以为nil
+	OnEvent      func(WatchEvent)                            // 事件回调，可以为nil
+}
+
+// rescanInterval inotify模式下完整扫描的间隔，用于补偿丢失的事件
+const rescanInterval = time.Minute
+
+// fileSig 文件的大小和修改时间
+type fileSig struct {
+	size  int64
+	mtime time.Time
+}
+
+// pendingFile 等待稳定的文件
+type pendingFile struct {
+	sig       fileSig
+	since     time.Time
+	uploading bool // 已交给上传协程，等待结果
+}
+
+// watchJob 交给上传协程的上传或删除任务
+type watchJob struct {
+	rel      string
+	sig      fileSig
+	uploaded *fileSig // 上次上传的文件大小和修改时间，nil为未上传过
+	delete   bool     // 删除对象（MirrorDelete）
+	event    WatchEvent
+}
+
+// watchResult 上传任务的结果
+type watchResult struct {
+	job watchJob
+	err error
+}
+
+// notifyEvent 文件系统通知事件
+type notifyEvent struct {
+	path     string // 发生变化的文件或目录全路径
+	isDir    bool
+	removed  bool // 被删除或移出
+	overflow bool // 事件队列溢出，需要完整扫描
+}
+
+// dirNotifier 文件系统通知，Linux上为inotify
+type dirNotifier interface {
+	add(dir string) error
+	events() <-chan notifyEvent
+	close() error
+}
+
+// Watcher 监视本地目录，自动上传新建和修改的文件
+type Watcher struct {
+	client   ClientStruct
+	opts     WatchOptions
+	root     string
+	notifier dirNotifier // nil为轮询模式
+	known    map[string]fileSig
+	pending  map[string]*pendingFile
+	dirs     map[string]bool // 已创建的桶下目录，只由上传协程访问
+	queue    []watchJob      // 等待交给上传协程的任务
+	jobs     chan watchJob
+	results  chan watchResult
+	lastScan time.Time
+	rescan   bool
+	done     chan struct{}
+	wg       sync.WaitGroup
+	once     sync.Once
+}
+
+// WatchDir 开始监视一个本地目录，在后台上传新建和修改的文件到桶下目录
+// Linux上使用inotify，不支持时回退为轮询扫描；调用Watcher.Close停止监视
+// 上传和删除由一个后台协程按顺序执行，大文件上传期间仍继续接收文件变化
+func (client ClientStruct) WatchDir(opts WatchOptions) (*Watcher, error) {
+	if opts.LocalDir == "" || opts.BucketName == "" {
+		return nil, errors.New("LocalDir and BucketName can not be empty")
+	}
+	if opts.StableFor <= 0 {
+		opts.StableFor = 2 * time.Second
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	root, err := filepath.Abs(opts.LocalDir)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(root); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, errors.New(root + " is not a directory")
+	}
+
+	w := &Watcher{
+		client:  client,
+		opts:    opts,
+		root:    root,
+		known:   make(map[string]fileSig),
+		pending: make(map[string]*pendingFile),
+		dirs:    make(map[string]bool),
+		jobs:    make(chan watchJob),
+		results: make(chan watchResult),
+		done:    make(chan struct{}),
+	}
+	if !opts.ForcePolling {
+		if n, err := newDirNotifier(); err == nil {
+			w.notifier = n
+		}
+	}
+
+	// 扫描时添加全部目录的监视
+	w.scan(time.Now(), !opts.InitialSync)
+	w.wg.Add(2)
+	go w.loop()
+	go w.worker()
+	return w, nil
+}
+
+// Polling 启动时是否为轮询模式
+func (w *Watcher) Polling() bool {
+	return w.notifier == nil
+}
+
+// Close 停止监视，等待正在进行的上传结束
+func (w *Watcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		if w.notifier != nil {
+			err = w.notifier.close()
+		}
+		w.wg.Wait()
+	})
+	return err
+}
+
+func (w *Watcher) emit(e WatchEvent) {
+	if w.opts.OnEvent != nil {
+		w.opts.OnEvent(e)
+	}
+}
+
+func (w *Watcher) loop() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+
+	var events <-chan notifyEvent
+	polling := w.notifier == nil
+	if !polling {
+		events = w.notifier.events()
+	}
+	for {
+		var jobs chan watchJob
+		var job watchJob
+		if len(w.queue) > 0 {
+			jobs, job = w.jobs, w.queue[0]
+		}
+		select {
+		case <-w.done:
+			return
+		case jobs <- job:
+			w.queue = w.queue[1:]
+		case r := <-w.results:
+			w.finished(r, time.Now())
+		case ev, ok := <-events:
+			if !ok {
+				// 通知失败，回退为轮询
+				events = nil
+				polling = true
+				continue
+			}
+			w.handleNotify(ev, time.Now())
+		case now := <-ticker.C:
+			if polling || w.rescan || now.Sub(w.lastScan) >= rescanInterval {
+				w.scan(now, false)
+			}
+			w.process(now)
+		}
+	}
+}
+
+// rel 本地全路径转换为相对路径，以"/"分隔
+func (w *Watcher) rel(path string) (string, bool) {
+	r, err := filepath.Rel(w.root, path)
+	if err != nil || r == "." || strings.HasPrefix(r, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(r), true
+}
+
+// objPathName 相对路径对应的桶下全路径对象名称
+func (w *Watcher) objPathName(rel string) string {
+	return buildPath([]string{w.opts.RemoteDir, rel})
+}
+
+func (w *Watcher) handleNotify(ev notifyEvent, now time.Time) {
+	if ev.overflow {
+		w.rescan = true
+		return
+	}
+	rel, ok := w.rel(ev.path)
+	if !ok {
+		return
+	}
+	if ev.removed {
+		w.removed(rel)
+		return
+	}
+	if ev.isDir {
+		// 新建或移入的目录，监视并检查其中已有的文件
+		w.walk(ev.path, func(r string, fi os.FileInfo) {
+			w.observe(r, fi, now, false)
+		})
+		return
+	}
+	fi, err := os.Stat(ev.path)
+	if err != nil {
+		w.removed(rel)
+		return
+	}
+	w.observe(rel, fi, now, false)
+}
+
+// walk 遍历目录下的文件，并监视全部子目录
+func (w *Watcher) walk(dir string, fn func(rel string, fi os.FileInfo)) map[string]bool {
+	seen := make(map[string]bool)
+	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if fi.IsDir() {
+			if w.notifier != nil {
+				w.notifier.add(path)
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		if rel, ok := w.rel(path); ok {
+			seen[rel] = true
+			fn(rel, fi)
+		}
+		return nil
+	})
+	return seen
+}
+
+// scan 完整扫描，检查全部文件并发现已删除的文件
+// param baseline: 为true时把当前文件记为已上传，用于启动时不上传已有文件
+func (w *Watcher) scan(now time.Time, baseline bool) {
+	w.lastScan = now
+	w.rescan = false
+	seen := w.walk(w.root, func(rel string, fi os.FileInfo) {
+		w.observe(rel, fi, now, baseline)
+	})
+	for rel := range w.known {
+		if !seen[rel] {
+			w.removed(rel)
+		}
+	}
+	for rel := range w.pending {
+		if !seen[rel] {
+			delete(w.pending, rel)
+		}
+	}
+}
+
+// observe 记录文件的变化，文件与已上传的不同时等待其稳定
+func (w *Watcher) observe(rel string, fi os.FileInfo, now time.Time, baseline bool) {
+	if w.opts.Filter != nil && !w.opts.Filter(rel, fi) {
+		return
+	}
+	sig := fileSig{size: fi.Size(), mtime: fi.ModTime()}
+	if baseline {
+		w.known[rel] = sig
+		return
+	}
+	if k, ok := w.known[rel]; ok && k == sig {
+		delete(w.pending, rel)
+		return
+	}
+	if p, ok := w.pending[rel]; ok && p.sig == sig {
+		return
+	}
+	w.pending[rel] = &pendingFile{sig: sig, since: now}
+}
+
+// removed 本地文件或目录已删除
+func (w *Watcher) removed(rel string) {
+	var rels []string
+	for r := range w.known {
+		if r == rel || strings.HasPrefix(r, rel+"/") {
+			rels = append(rels, r)
+		}
+	}
+	for r := range w.pending {
+		if r == rel || strings.HasPrefix(r, rel+"/") {
+			delete(w.pending, r)
+		}
+	}
+
+	for _, r := range rels {
+		delete(w.known, r)
+		if !w.opts.MirrorDelete {
+			continue
+		}
+		e := WatchEvent{Type: WatchDeleted, LocalPath: filepath.Join(w.root, filepath.FromSlash(r)), ObjPathName: w.objPathName(r)}
+		w.queue = append(w.queue, watchJob{rel: r, delete: true, event: e})
+	}
+}
+
+// process 把已稳定的文件交给上传协程
+func (w *Watcher) process(now time.Time) {
+	for rel, p := range w.pending {
+		if p.uploading || now.Sub(p.since) < w.opts.StableFor {
+			continue
+		}
+
+		path := filepath.Join(w.root, filepath.FromSlash(rel))
+		fi, err := os.Stat(path)
+		if err != nil {
+			delete(w.pending, rel)
+			w.removed(rel)
+			continue
+		}
+		sig := fileSig{size: fi.Size(), mtime: fi.ModTime()}
+		if sig != p.sig {
+			// 仍在写入
+			p.sig = sig
+			p.since = now
+			continue
+		}
+
+		job := watchJob{rel: rel, sig: sig, event: WatchEvent{Type: WatchUploaded, LocalPath: path, ObjPathName: w.objPathName(rel)}}
+		if k, ok := w.known[rel]; ok {
+			job.uploaded = &k
+		}
+		p.uploading = true
+		w.queue = append(w.queue, job)
+	}
+}
+
+// finished 记录上传协程的结果，上传期间文件又有变化时保留等待稳定的记录
+func (w *Watcher) finished(r watchResult, now time.Time) {
+	if r.job.delete {
+		return
+	}
+	rel := r.job.rel
+	p := w.pending[rel]
+	if p != nil {
+		p.uploading = false
+	}
+	if r.err != nil {
+		if p != nil && p.sig == r.job.sig {
+			p.since = now
+		}
+		return
+	}
+	w.known[rel] = r.job.sig
+	if p != nil && p.sig == r.job.sig {
+		delete(w.pending, rel)
+	}
+}
+
+// worker 上传协程，按顺序执行上传和删除任务
+func (w *Watcher) worker() {
+	defer w.wg.Done()
+	for {
+		var job watchJob
+		select {
+		case <-w.done:
+			return
+		case job = <-w.jobs:
+		}
+
+		e := job.event
+		var err error
+		if job.delete {
+			err = w.deleteObject(w.remoteName(e.ObjPathName))
+		} else {
+			err = w.upload(e.ObjPathName, e.LocalPath, job.sig.size, job.uploaded)
+		}
+		if err != nil {
+			e.Type = WatchFailed
+			e.Err = err
+		}
+		w.emit(e)
+
+		select {
+		case <-w.done:
+			return
+		case w.results <- watchResult{job: job, err: err}:
+		}
+	}
+}
+
+// remoteName 服务器上的对象名称，配置了Compression时为加上编码后缀的压缩对象名称
+func (w *Watcher) remoteName(objPathName string) string {
+	if codec := w.client.API.configs.Compression; codec != nil {
+		return compressedName(codec, objPathName)
+	}
+	return objPathName
+}
+
+// deleteObject 删除对象，对象不存在视为成功
+func (w *Watcher) deleteObject(objPathName string) error {
+	ret, err := w.client.DeleteObject(w.opts.BucketName, objPathName)
+	if err != nil {
+		return err
+	}
+	if !ret.Ok && ret.Code != 404 {
+		return *ret
+	}
+	return nil
+}
+
+// upload 创建桶下目录并上传文件
+// 分片上传不会截断对象，文件比上次上传的小时先删除对象；未上传过时根据对象的大小判断
+func (w *Watcher) upload(objPathName, path string, size int64, uploaded *fileSig) error {
+	dirPath, _ := CutPathAndName(objPathName)
+	if err := w.makeDirAll(dirPath); err != nil {
+		return err
+	}
+
+	remoteName := w.remoteName(objPathName)
+	shrunk := uploaded != nil && size < uploaded.size
+	if uploaded == nil {
+		meta, err := w.client.WithCache(nil).GetMetadata(w.opts.BucketName, remoteName)
+		if err != nil {
+			return err
+		}
+		shrunk = meta.Ok && meta.Obj.IsObject() && int64(meta.Obj.Size) > size
+	}
+	if shrunk {
+		if err := w.deleteObject(remoteName); err != nil {
+			return err
+		}
+	}
+
+	ret, err := w.client.UploadObject(w.opts.BucketName, objPathName, path, 0)
+	if err != nil {
+		return err
+	}
+	if !ret.Ok {
+		return ret.Results
+	}
+	return nil
+}
+
+// makeDirAll 创建桶下目录及其父目录
+func (w *Watcher) makeDirAll(dirPathName string) error {
+	var cur string
+	for _, name := range strings.Split(dirPathName, "/") {
+		if name == "" {
+			continue
+		}
+		parent := cur
+		cur = buildPath([]string{cur, name})
+		if w.dirs[cur] {
+			continue
+		}
+		r, err := w.client.MakeDir(w.opts.BucketName, parent, name)
+		if err != nil {
+			return err
+		}
+		if !r.Ok {
+			return *r
+		}
+		w.dirs[cur] = true
+	}
+	return nil
+}
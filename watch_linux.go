@@ -0,0 +1,140 @@
+package goharbor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// inotifyNotifier 使用inotify的文件系统通知
+type inotifyNotifier struct {
+	fd   int
+	file *os.File // 非阻塞fd由runtime poller读取，Close可以中断读取
+	mu   sync.Mutex
+	wds  map[int32]string // 监视描述符 -> 目录
+	dirs map[string]int32
+	ch   chan notifyEvent
+	done chan struct{}
+	shut bool
+}
+
+func newDirNotifier() (dirNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	n := &inotifyNotifier{
+		fd:   fd,
+		file: os.NewFile(uintptr(fd), "inotify"),
+		wds:  make(map[int32]string),
+		dirs: make(map[string]int32),
+		ch:   make(chan notifyEvent, 256),
+		done: make(chan struct{}),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotifyNotifier) add(dir string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.shut {
+		return os.ErrClosed
+	}
+	if _, ok := n.dirs[dir]; ok {
+		return nil
+	}
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+	if err != nil {
+		return err
+	}
+	n.wds[int32(wd)] = dir
+	n.dirs[dir] = int32(wd)
+	return nil
+}
+
+func (n *inotifyNotifier) events() <-chan notifyEvent {
+	return n.ch
+}
+
+func (n *inotifyNotifier) close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.shut {
+		return nil
+	}
+	n.shut = true
+	close(n.done)
+	return n.file.Close()
+}
+
+// send 发送事件，已关闭时返回false
+func (n *inotifyNotifier) send(ev notifyEvent) bool {
+	select {
+	case n.ch <- ev:
+		return true
+	case <-n.done:
+		return false
+	}
+}
+
+// forget 删除目录及其子目录的监视记录，内核已自动移除被删除目录的监视
+func (n *inotifyNotifier) forget(dir string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for d, wd := range n.dirs {
+		if d == dir || strings.HasPrefix(d, dir+string(filepath.Separator)) {
+			delete(n.dirs, d)
+			delete(n.wds, wd)
+		}
+	}
+}
+
+func (n *inotifyNotifier) read() {
+	defer close(n.ch)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		size, err := n.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= size; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameStart := off + syscall.SizeofInotifyEvent
+			off = nameStart + int(raw.Len)
+			if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				if !n.send(notifyEvent{overflow: true}) {
+					return
+				}
+				continue
+			}
+			if raw.Mask&syscall.IN_IGNORED != 0 || raw.Len == 0 {
+				continue
+			}
+			n.mu.Lock()
+			dir, ok := n.wds[raw.Wd]
+			n.mu.Unlock()
+			if !ok {
+				continue
+			}
+			name := strings.TrimRight(string(buf[nameStart:off]), "\x00")
+			ev := notifyEvent{
+				path:    filepath.Join(dir, name),
+				isDir:   raw.Mask&syscall.IN_ISDIR != 0,
+				removed: raw.Mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0,
+			}
+			if ev.isDir && ev.removed {
+				n.forget(ev.path)
+			}
+			if !n.send(ev) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package goharbor
+
+import "errors"
+
+// newDirNotifier 非Linux平台不支持文件系统通知，使用轮询
+func newDirNotifier() (dirNotifier, error) {
+	return nil, errors.New("file system notification is not supported on this platform")
+}
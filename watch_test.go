@@ -0,0 +1,204 @@
+package goharbor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testWatchDir(t *testing.T, polling bool) {
+	var mu sync.Mutex
+	var mkdirs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "/dir/"):
+			mu.Lock()
+			mkdirs = append(mkdirs, r.URL.Path)
+			mu.Unlock()
+			w.WriteHeader(201)
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(204)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"code_text": "ok"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := testClient(server.URL)
+
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "old.txt"), []byte("old"), 0644)
+
+	events := make(chan WatchEvent, 20)
+	w, err := client.WatchDir(WatchOptions{
+		LocalDir:     dir,
+		BucketName:   "b",
+		RemoteDir:    "backup",
+		StableFor:    50 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+		ForcePolling: polling,
+		MirrorDelete: true,
+		Filter: func(rel string, fi os.FileInfo) bool {
+			return !strings.HasSuffix(rel, ".tmp")
+		},
+		OnEvent: func(e WatchEvent) { events <- e },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if w.Polling() != polling {
+		t.Errorf("Polling() = %v", w.Polling())
+	}
+
+	next := func() WatchEvent {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for watch event")
+		}
+		return WatchEvent{}
+	}
+
+	// 新建子目录中的文件，已有的文件和被过滤的文件不上传
+	os.MkdirAll(filepath.Join(dir, "a", "b"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a", "b", "x.tmp"), []byte("tmp"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "a", "b", "new.txt"), []byte("new"), 0644)
+	if e := next(); e.Type != WatchUploaded || e.ObjPathName != "backup/a/b/new.txt" || e.Err != nil {
+		t.Fatalf("event = %+v", e)
+	}
+	mu.Lock()
+	if len(mkdirs) != 3 {
+		t.Errorf("MakeDir requests = %v", mkdirs)
+	}
+	mu.Unlock()
+
+	// 修改后重新上传
+	ioutil.WriteFile(filepath.Join(dir, "old.txt"), []byte("modified"), 0644)
+	if e := next(); e.Type != WatchUploaded || e.ObjPathName != "backup/old.txt" {
+		t.Fatalf("event = %+v", e)
+	}
+
+	os.Remove(filepath.Join(dir, "old.txt"))
+	if e := next(); e.Type != WatchDeleted || e.ObjPathName != "backup/old.txt" || e.Err != nil {
+		t.Fatalf("event = %+v", e)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %+v", e)
+	default:
+	}
+}
+
+func TestWatchDir(t *testing.T) {
+	t.Run("notify", func(t *testing.T) { testWatchDir(t, false) })
+	t.Run("polling", func(t *testing.T) { testWatchDir(t, true) })
+}
+
+func TestWatchDirShrink(t *testing.T) {
+	s := newMemObjectServer()
+	defer s.Close()
+	s.set("b/pre.txt", []byte("old remote content"))
+
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "pre.txt"), []byte("local"), 0644)
+
+	events := make(chan WatchEvent, 20)
+	w, err := s.client().WatchDir(WatchOptions{
+		LocalDir:     dir,
+		BucketName:   "b",
+		StableFor:    50 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+		ForcePolling: true,
+		InitialSync:  true,
+		OnEvent:      func(e WatchEvent) { events <- e },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	uploaded := func(obj, want string) {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.Type != WatchUploaded || e.ObjPathName != obj {
+				t.Fatalf("event = %+v", e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for watch event")
+		}
+		if data, _ := s.get("b/" + obj); string(data) != want {
+			t.Errorf("object %s = %q, want %q", obj, data, want)
+		}
+	}
+
+	// 远端已有更大的对象
+	uploaded("pre.txt", "local")
+
+	// 文件变小后重新上传，不残留旧数据
+	file := filepath.Join(dir, "x.txt")
+	ioutil.WriteFile(file, []byte("hello world"), 0644)
+	uploaded("x.txt", "hello world")
+	ioutil.WriteFile(file, []byte("hi"), 0644)
+	uploaded("x.txt", "hi")
+}
+
+func TestWatchDirCompression(t *testing.T) {
+	s := newMemObjectServer()
+	defer s.Close()
+	dir := t.TempDir()
+
+	events := make(chan WatchEvent, 20)
+	client := s.client().WithCompression(Gzip)
+	w, err := client.WatchDir(WatchOptions{
+		LocalDir:     dir,
+		BucketName:   "b",
+		StableFor:    50 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+		ForcePolling: true,
+		MirrorDelete: true,
+		OnEvent:      func(e WatchEvent) { events <- e },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	next := func(typ WatchEventType) {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.Type != typ || e.Err != nil {
+				t.Fatalf("event = %+v", e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for watch event")
+		}
+	}
+
+	// 压缩上传的对象名称有编码后缀，删除本地文件时删除压缩对象
+	file := filepath.Join(dir, "x.txt")
+	ioutil.WriteFile(file, []byte("hello world"), 0644)
+	next(WatchUploaded)
+	if _, ok := s.get("b/x.txt.gz"); !ok {
+		t.Fatal("compressed object not uploaded")
+	}
+	os.Remove(file)
+	next(WatchDeleted)
+	if _, ok := s.get("b/x.txt.gz"); ok {
+		t.Error("compressed object not deleted")
+	}
+}